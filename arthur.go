@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math/big"
 
-	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/frontend"
 	bits2 "github.com/consensys/gnark/std/math/bits"
 	"github.com/consensys/gnark/std/math/uints"
@@ -17,39 +16,189 @@ type Arthur interface {
 	FillChallengeBytes(uints []uints.U8) error
 	FillNextScalars(scalars []frontend.Variable) error
 	FillChallengeScalars(scalars []frontend.Variable) error
+	FillChallengeIndices(count, unique, domainBits int) ([]frontend.Variable, [][]frontend.Variable, error)
+	FillNextHint(uints []uints.U8) error
+	ChallengePoW(bits int) error
+	Ratchet() error
+	Finish() error
 	PrintState(api frontend.API)
 }
 
+// ArthurOption configures optional checks of an Arthur.
+type ArthurOption func(*arthurConfig)
+
+type arthurConfig struct {
+	strictScalars bool
+	powStrategy   PoWStrategy
+	digestKind    DigestKind
+	digest        frontend.Variable
+	profiler      *Profiler
+}
+
+// WithStrictScalars makes FillNextScalars and FillNextEmulatedScalars
+// constrain every decoded scalar to be a canonical encoding, i.e. less than
+// the native or emulated modulus. Without it a prover may send an encoding
+// that wraps around the modulus.
+func WithStrictScalars() ArthurOption {
+	return func(config *arthurConfig) {
+		config.strictScalars = true
+	}
+}
+
+// WithPoWStrategy selects the hash checked by ChallengePoW. The default is
+// Blake3PoW. Arthurs over field sponges reject PoW challenges.
+func WithPoWStrategy(strategy PoWStrategy) ArthurOption {
+	return func(config *arthurConfig) {
+		config.powStrategy = strategy
+	}
+}
+
+// WithTranscriptDigest makes the Arthur constrain the transcript to hash to
+// digest. With the transcript a private witness and the digest public, a
+// proof has one public input for the whole transcript.
+func WithTranscriptDigest(kind DigestKind, digest frontend.Variable) ArthurOption {
+	return func(config *arthurConfig) {
+		config.digestKind = kind
+		config.digest = digest
+	}
+}
+
+// strictArthur is implemented by the Arthurs of this package, so that helpers
+// taking an Arthur can honour WithStrictScalars.
+type strictArthur interface {
+	strictScalars() bool
+}
+
+// newArthurConfig applies the options and adds the constraints they require
+// on the whole transcript.
+func newArthurConfig(api frontend.API, transcript []uints.U8, opts []ArthurOption) (arthurConfig, error) {
+	var config arthurConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.digest != nil {
+		digest, err := TranscriptDigest(api, config.digestKind, transcript)
+		if err != nil {
+			return config, err
+		}
+		api.AssertIsEqual(digest, config.digest)
+	}
+	return config, nil
+}
+
+// isGreaterThanConst returns 1 if the little-endian bits encode an integer
+// greater than c and 0 otherwise.
+func isGreaterThanConst(api frontend.API, leBits []frontend.Variable, c *big.Int) frontend.Variable {
+	gt := frontend.Variable(0)
+	eq := frontend.Variable(1)
+	for i := len(leBits) - 1; i >= 0; i-- {
+		if c.Bit(i) == 0 {
+			gt = api.Or(gt, api.And(eq, leBits[i]))
+			eq = api.And(eq, api.Sub(1, leBits[i]))
+		} else {
+			eq = api.And(eq, leBits[i])
+		}
+	}
+	return gt
+}
+
+// assertCanonical constrains the little-endian bytes to encode an integer
+// smaller than modulus.
+func assertCanonical(api frontend.API, bytes []uints.U8, modulus *big.Int) {
+	leBits := make([]frontend.Variable, 0, 8*len(bytes))
+	for _, b := range bytes {
+		leBits = append(leBits, bits2.ToBinary(api, b.Val, bits2.WithNbDigits(8))...)
+	}
+	maxValue := new(big.Int).Sub(modulus, big.NewInt(1))
+	api.AssertIsEqual(isGreaterThanConst(api, leBits, maxValue), 0)
+}
+
+// hintLengthBytes is the size of the little-endian u32 length prefix nimue
+// writes in front of every hint.
+const hintLengthBytes = 4
+
+// splitTranscript returns the next n transcript bytes and the rest of the
+// transcript, or an error if fewer than n bytes are left.
+func splitTranscript(transcript []uints.U8, n int) ([]uints.U8, []uints.U8, error) {
+	if len(transcript) < n {
+		return nil, nil, fmt.Errorf("transcript too short: need %d bytes, have %d", n, len(transcript))
+	}
+	return transcript[:n], transcript[n:], nil
+}
+
+// fillHint reads a length-prefixed hint of len(out) bytes from the transcript
+// and returns the rest of the transcript. Hints are not absorbed.
+func fillHint(api frontend.API, transcript []uints.U8, out []uints.U8) ([]uints.U8, error) {
+	prefix, transcript, err := splitTranscript(transcript, hintLengthBytes)
+	if err != nil {
+		return nil, err
+	}
+	length := frontend.Variable(0)
+	for i := hintLengthBytes - 1; i >= 0; i-- {
+		length = api.Add(api.Mul(length, 256), prefix[i].Val)
+	}
+	api.AssertIsEqual(length, len(out))
+	hint, transcript, err := splitTranscript(transcript, len(out))
+	if err != nil {
+		return nil, err
+	}
+	copy(out, hint)
+	return transcript, nil
+}
+
+// finish checks that both the IO pattern and the transcript were consumed.
+func finish[U any, H hash.DuplexHash[U]](safe *Safe[U, H], transcript []uints.U8) error {
+	err := safe.Finish()
+	if err != nil {
+		return err
+	}
+	if len(transcript) > 0 {
+		return fmt.Errorf("transcript has %d unread bytes", len(transcript))
+	}
+	return nil
+}
+
 type byteArthur[H hash.DuplexHash[uints.U8]] struct {
 	api        frontend.API
 	transcript []uints.U8
 	safe       *Safe[uints.U8, H]
+	config     arthurConfig
 }
 
-func NewByteArthur[S hash.DuplexHash[uints.U8]](api frontend.API, io []byte, transcript []uints.U8, hash S, ignoreHints bool) (Arthur, error) {
+func NewByteArthur[S hash.DuplexHash[uints.U8]](api frontend.API, io []byte, transcript []uints.U8, hash S, ignoreHints bool, opts ...ArthurOption) (Arthur, error) {
 	safe, err := NewSafe[uints.U8, S](hash, io, ignoreHints)
 	if err != nil {
 		return nil, err
 	}
+	config, err := newArthurConfig(api, transcript, opts)
+	if err != nil {
+		return nil, err
+	}
+	safe.SetProfiler(config.profiler)
 	return &byteArthur[S]{
 		api,
 		transcript,
 		safe,
+		config,
 	}, nil
 }
 
-func NewKeccakArthur(api frontend.API, io []byte, transcript []uints.U8, ignoreHints bool) (Arthur, error) {
+func NewKeccakArthur(api frontend.API, io []byte, transcript []uints.U8, ignoreHints bool, opts ...ArthurOption) (Arthur, error) {
 	sponge, err := hash.NewKeccak(api)
 	if err != nil {
 		return nil, err
 	}
-	return NewByteArthur[hash.Keccak](api, io, transcript, sponge, ignoreHints)
+	return NewByteArthur[hash.Keccak](api, io, transcript, sponge, ignoreHints, opts...)
 }
 
 func (arthur *byteArthur[H]) FillNextBytes(uints []uints.U8) error {
-	copy(uints, arthur.transcript)
-	arthur.transcript = arthur.transcript[len(uints):]
-	err := arthur.safe.Absorb(uints)
+	next, rest, err := splitTranscript(arthur.transcript, len(uints))
+	if err != nil {
+		return err
+	}
+	copy(uints, next)
+	arthur.transcript = rest
+	err = arthur.safe.Absorb(uints)
 	if err != nil {
 		return err
 	}
@@ -60,6 +209,10 @@ func (arthur *byteArthur[H]) FillChallengeBytes(uints []uints.U8) error {
 	return arthur.safe.Squeeze(uints)
 }
 
+func (arthur *byteArthur[H]) strictScalars() bool {
+	return arthur.config.strictScalars
+}
+
 func (arthur *byteArthur[H]) FillNextScalars(scalars []frontend.Variable) error {
 	bytesToRead := (arthur.api.Compiler().FieldBitLen() + 7) / 8
 	bytes := make([]uints.U8, bytesToRead)
@@ -69,6 +222,9 @@ func (arthur *byteArthur[H]) FillNextScalars(scalars []frontend.Variable) error
 		if err != nil {
 			return err
 		}
+		if arthur.config.strictScalars {
+			assertCanonical(arthur.api, bytes, arthur.api.Compiler().Field())
+		}
 		curMul := big.NewInt(1)
 		for _, b := range bytes {
 			scalars[i] = arthur.api.Add(scalars[i], arthur.api.Mul(b.Val, curMul))
@@ -94,6 +250,31 @@ func (arthur *byteArthur[H]) FillChallengeScalars(scalars []frontend.Variable) e
 	return nil
 }
 
+func (arthur *byteArthur[H]) FillChallengeIndices(count, unique, domainBits int) ([]frontend.Variable, [][]frontend.Variable, error) {
+	return fillChallengeIndices(arthur.api, arthur, count, unique, domainBits)
+}
+
+func (arthur *byteArthur[H]) FillNextHint(uints []uints.U8) error {
+	err := arthur.safe.Hint()
+	if err != nil {
+		return err
+	}
+	arthur.transcript, err = fillHint(arthur.api, arthur.transcript, uints)
+	return err
+}
+
+func (arthur *byteArthur[H]) ChallengePoW(bits int) error {
+	return challengePoW(arthur.api, arthur, arthur.config.powStrategy, bits)
+}
+
+func (arthur *byteArthur[H]) Ratchet() error {
+	return arthur.safe.Ratchet()
+}
+
+func (arthur *byteArthur[H]) Finish() error {
+	return finish(arthur.safe, arthur.transcript)
+}
+
 func (arthur *byteArthur[H]) PrintState(api frontend.API) {
 	msg := fmt.Sprintf("remaining transcript bytes: %d", len(arthur.transcript))
 	api.Println(msg)
@@ -104,25 +285,66 @@ type nativeArthur[H hash.DuplexHash[frontend.Variable]] struct {
 	api        frontend.API
 	transcript []uints.U8
 	safe       *Safe[frontend.Variable, H]
+	config     arthurConfig
 }
 
 func (arthur *nativeArthur[H]) FillNextBytes(uints []uints.U8) error {
-	copy(uints, arthur.transcript)
-	for _, i := range uints {
-		err := arthur.safe.Absorb([]frontend.Variable{i.Val})
+	next, rest, err := splitTranscript(arthur.transcript, len(uints))
+	if err != nil {
+		return err
+	}
+	copy(uints, next)
+	// one field element per byte, absorbed in a single call. An empty absorb
+	// would still reset the squeeze position of the sponge, so it is skipped.
+	if len(uints) > 0 {
+		elements := make([]frontend.Variable, len(uints))
+		for i := range uints {
+			elements[i] = uints[i].Val
+		}
+		err = arthur.safe.Absorb(elements)
 		if err != nil {
 			return err
 		}
 	}
-	arthur.transcript = arthur.transcript[len(uints):]
+	arthur.transcript = rest
 	return nil
 }
 
-func randomBytesInModulus(api frontend.API) (int, error) {
-	if api.Compiler().Field().Cmp(ecc.BN254.ScalarField()) == 0 {
-		return 15, nil
+// randomBitsInField returns how many low-order bits of a uniformly random
+// element of the field are statistically close (within 2^-128) to uniform
+// bits, ported from random_bits_in_random_modp of nimue. Only the elements
+// above the largest multiple of 2^n below the modulus bias the low n bits, so
+// fields close to a power of two give almost all their bits.
+func randomBitsInField(field *big.Int) int {
+	numBits := field.BitLen()
+	for n := numBits; n >= 0; n-- {
+		r := new(big.Int).Mod(field, new(big.Int).Lsh(big.NewInt(1), uint(n)))
+		// the number of bits of r below its leading ones
+		log2AMinusR := n
+		for log2AMinusR > 0 && r.Bit(log2AMinusR-1) == 1 {
+			log2AMinusR--
+		}
+		if numBits+n-1-r.BitLen()-log2AMinusR >= 128 {
+			return n
+		}
+	}
+	return 0
+}
+
+// randomBytesInField returns how many low-order bytes of a uniformly random
+// field element are statistically close to uniform bytes, as
+// random_bytes_in_random_modp of nimue. This is 15 for the BN254, BLS12-377
+// and BLS12-381 scalar fields and 31 for BW6-761.
+func randomBytesInField(field *big.Int) (int, error) {
+	numBytes := randomBitsInField(field) / 8
+	if numBytes <= 0 {
+		return 0, fmt.Errorf("field of %d bits is too small to extract random bytes", field.BitLen())
 	}
-	return 0, fmt.Errorf("unsupported field")
+	return numBytes, nil
+}
+
+func randomBytesInModulus(api frontend.API) (int, error) {
+	return randomBytesInField(api.Compiler().Field())
 }
 
 func (arthur *nativeArthur[H]) FillChallengeBytes(out []uints.U8) error {
@@ -158,11 +380,35 @@ func (arthur *nativeArthur[H]) FillChallengeBytes(out []uints.U8) error {
 	return nil
 }
 
+func (arthur *nativeArthur[H]) readBytes(out []uints.U8) error {
+	next, rest, err := splitTranscript(arthur.transcript, len(out))
+	if err != nil {
+		return err
+	}
+	copy(out, next)
+	arthur.transcript = rest
+	return nil
+}
+
+func (arthur *nativeArthur[H]) absorbUnits(units []frontend.Variable) error {
+	return arthur.safe.Absorb(units)
+}
+
+func (arthur *nativeArthur[H]) strictScalars() bool {
+	return arthur.config.strictScalars
+}
+
 func (arthur *nativeArthur[H]) FillNextScalars(out []frontend.Variable) error {
 	wordSize := (arthur.api.Compiler().FieldBitLen() + 7) / 8
 	for i := range out {
-		bytes := arthur.transcript[:wordSize]
-		arthur.transcript = arthur.transcript[wordSize:]
+		bytes, rest, err := splitTranscript(arthur.transcript, wordSize)
+		if err != nil {
+			return err
+		}
+		arthur.transcript = rest
+		if arthur.config.strictScalars {
+			assertCanonical(arthur.api, bytes, arthur.api.Compiler().Field())
+		}
 		out[i] = frontend.Variable(0)
 		curMul := big.NewInt(1)
 		for _, b := range bytes {
@@ -178,15 +424,65 @@ func (arthur *nativeArthur[H]) FillChallengeScalars(out []frontend.Variable) err
 	return arthur.safe.Squeeze(out)
 }
 
+func (arthur *nativeArthur[H]) FillChallengeIndices(count, unique, domainBits int) ([]frontend.Variable, [][]frontend.Variable, error) {
+	return fillChallengeIndices(arthur.api, arthur, count, unique, domainBits)
+}
+
+func (arthur *nativeArthur[H]) FillNextHint(uints []uints.U8) error {
+	err := arthur.safe.Hint()
+	if err != nil {
+		return err
+	}
+	arthur.transcript, err = fillHint(arthur.api, arthur.transcript, uints)
+	return err
+}
+
+func (arthur *nativeArthur[H]) ChallengePoW(bits int) error {
+	return fieldPoWError()
+}
+
+func (arthur *nativeArthur[H]) Ratchet() error {
+	return arthur.safe.Ratchet()
+}
+
+func (arthur *nativeArthur[H]) Finish() error {
+	return finish(arthur.safe, arthur.transcript)
+}
+
 func (arthur *nativeArthur[H]) PrintState(api frontend.API) {
 	arthur.safe.sponge.PrintState(api)
 }
 
-func NewSkyscraperArthur(api frontend.API, sc *skyscraper.Skyscraper, io []byte, transcript []uints.U8, ignoreHints bool) (Arthur, error) {
+func NewSkyscraperArthur(api frontend.API, sc *skyscraper.Skyscraper, io []byte, transcript []uints.U8, ignoreHints bool, opts ...ArthurOption) (Arthur, error) {
 	sponge, err := hash.NewSkyScraper(sc)
 	if err != nil {
 		return nil, err
 	}
 	safe, err := NewSafe[frontend.Variable, hash.Skyscraper](sponge, io, ignoreHints)
-	return &nativeArthur[hash.Skyscraper]{api, transcript, safe}, nil
+	if err != nil {
+		return nil, err
+	}
+	config, err := newArthurConfig(api, transcript, opts)
+	if err != nil {
+		return nil, err
+	}
+	safe.SetProfiler(config.profiler)
+	return &nativeArthur[hash.Skyscraper]{api, transcript, safe, config}, nil
+}
+
+func NewPoseidon2Arthur(api frontend.API, io []byte, transcript []uints.U8, ignoreHints bool, opts ...ArthurOption) (Arthur, error) {
+	sponge, err := hash.NewPoseidon2(api)
+	if err != nil {
+		return nil, err
+	}
+	safe, err := NewSafe[frontend.Variable, hash.Poseidon2](sponge, io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	config, err := newArthurConfig(api, transcript, opts)
+	if err != nil {
+		return nil, err
+	}
+	safe.SetProfiler(config.profiler)
+	return &nativeArthur[hash.Poseidon2]{api, transcript, safe, config}, nil
 }
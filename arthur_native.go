@@ -0,0 +1,128 @@
+package gnark_nimue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+// NativeArthur is the out-of-circuit counterpart of Arthur. It checks a
+// transcript against an IO pattern in plain Go, deriving the same challenges
+// the circuit would, so malformed transcripts can be rejected before proving.
+type NativeArthur interface {
+	FillNextBytes(bytes []byte) error
+	FillChallengeBytes(bytes []byte) error
+	FillNextScalars(scalars []*big.Int) error
+	FillChallengeScalars(scalars []*big.Int) error
+	FillNextHint(hint []byte) error
+	Ratchet() error
+	Finish() error
+}
+
+// replayArthur verifies a transcript by replaying it through a Merlin, which
+// keeps the encoding rules of both sides in one place.
+type replayArthur struct {
+	field      *big.Int
+	transcript []byte
+	merlin     Merlin
+}
+
+func NewKeccakNativeArthur(field *big.Int, io []byte, transcript []byte, ignoreHints bool) (NativeArthur, error) {
+	merlin, err := NewKeccakMerlin(field, io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	return &replayArthur{field, transcript, merlin}, nil
+}
+
+func NewSkyscraperNativeArthur(io []byte, transcript []byte, ignoreHints bool) (NativeArthur, error) {
+	merlin, err := NewSkyscraperMerlin(io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	return &replayArthur{ecc.BN254.ScalarField(), transcript, merlin}, nil
+}
+
+func NewPoseidon2NativeArthur(io []byte, transcript []byte, ignoreHints bool) (NativeArthur, error) {
+	merlin, err := NewPoseidon2Merlin(io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	return &replayArthur{ecc.BN254.ScalarField(), transcript, merlin}, nil
+}
+
+func (arthur *replayArthur) readTranscript(n int) ([]byte, error) {
+	if len(arthur.transcript) < n {
+		return nil, fmt.Errorf("transcript too short: need %d bytes, have %d", n, len(arthur.transcript))
+	}
+	bytes := arthur.transcript[:n]
+	arthur.transcript = arthur.transcript[n:]
+	return bytes, nil
+}
+
+func (arthur *replayArthur) FillNextBytes(bytes []byte) error {
+	next, err := arthur.readTranscript(len(bytes))
+	if err != nil {
+		return err
+	}
+	copy(bytes, next)
+	return arthur.merlin.AddBytes(bytes)
+}
+
+func (arthur *replayArthur) FillChallengeBytes(bytes []byte) error {
+	return arthur.merlin.ChallengeBytes(bytes)
+}
+
+func (arthur *replayArthur) FillNextScalars(scalars []*big.Int) error {
+	wordSize := (arthur.field.BitLen() + 7) / 8
+	for i := range scalars {
+		bytes, err := arthur.readTranscript(wordSize)
+		if err != nil {
+			return err
+		}
+		scalars[i] = new(big.Int)
+		for j := len(bytes) - 1; j >= 0; j-- {
+			scalars[i].Lsh(scalars[i], 8)
+			scalars[i].Or(scalars[i], big.NewInt(int64(bytes[j])))
+		}
+	}
+	return arthur.merlin.AddScalars(scalars)
+}
+
+func (arthur *replayArthur) FillChallengeScalars(scalars []*big.Int) error {
+	return arthur.merlin.ChallengeScalars(scalars)
+}
+
+func (arthur *replayArthur) FillNextHint(hint []byte) error {
+	prefix, err := arthur.readTranscript(hintLengthBytes)
+	if err != nil {
+		return err
+	}
+	length := binary.LittleEndian.Uint32(prefix)
+	if uint64(length) != uint64(len(hint)) {
+		return fmt.Errorf("hint length mismatch: transcript has %d bytes, expected %d", length, len(hint))
+	}
+	next, err := arthur.readTranscript(len(hint))
+	if err != nil {
+		return err
+	}
+	copy(hint, next)
+	return arthur.merlin.AddHint(hint)
+}
+
+func (arthur *replayArthur) Ratchet() error {
+	return arthur.merlin.Ratchet()
+}
+
+func (arthur *replayArthur) Finish() error {
+	err := arthur.merlin.Finish()
+	if err != nil {
+		return err
+	}
+	if len(arthur.transcript) > 0 {
+		return fmt.Errorf("transcript has %d unread bytes", len(arthur.transcript))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package gnark_nimue
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/stretchr/testify/assert"
+)
+
+const badIOPat = "bad-protocol\u0000S8first challenge\u0000A8first reply\u0000S16second challenge\u0000A16second reply"
+
+// badTranscript was produced by the Rust nimue prover for badIOPat, see TestEndToEnd.
+var badTranscript = []byte{9, 2, 243, 247, 30, 73, 172, 83, 203, 176, 231, 217, 99, 6, 2, 176, 93, 1, 93, 32, 162, 116, 211, 219}
+
+func TestNativeArthurVerifiesNimueTranscript(t *testing.T) {
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(badIOPat), badTranscript, false)
+	assert.Nil(t, err)
+	for _, size := range []int{8, 16} {
+		challenge := make([]byte, size)
+		assert.Nil(t, arthur.FillChallengeBytes(challenge))
+		reply := make([]byte, size)
+		assert.Nil(t, arthur.FillNextBytes(reply))
+		assert.Equal(t, challenge, reply)
+	}
+	assert.Nil(t, arthur.Finish())
+}
+
+func TestNativeArthurFinish(t *testing.T) {
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(badIOPat), badTranscript, false)
+	assert.Nil(t, err)
+	assert.Nil(t, arthur.FillChallengeBytes(make([]byte, 8)))
+	assert.ErrorContains(t, arthur.Finish(), "unconsumed Absorb 8 first reply")
+
+	io := "leftover\u0000A1byte\u0000Hoptional"
+	arthur, err = NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(io), []byte{1, 2}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, arthur.FillNextBytes(make([]byte, 1)))
+	assert.ErrorContains(t, arthur.Finish(), "transcript has 1 unread bytes")
+}
+
+func TestNativeArthurRejectsShortTranscript(t *testing.T) {
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(badIOPat), badTranscript[:4], false)
+	assert.Nil(t, err)
+	assert.Nil(t, arthur.FillChallengeBytes(make([]byte, 8)))
+	assert.ErrorContains(t, arthur.FillNextBytes(make([]byte, 8)), "transcript too short")
+}
+
+func TestNativeArthurRejectsWrongOp(t *testing.T) {
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(badIOPat), badTranscript, false)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, arthur.FillNextBytes(make([]byte, 8)), "expected Absorb, got Squeeze")
+}
+
+func TestNativeArthurRejectsNonCanonicalScalar(t *testing.T) {
+	io := "scalars\u0000A1scalar"
+	transcript := make([]byte, 32)
+	for i := range transcript {
+		transcript[i] = 0xff
+	}
+	arthur, err := NewSkyscraperNativeArthur([]byte(io), transcript, false)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, arthur.FillNextScalars(make([]*big.Int, 1)), "not a canonical field element")
+}
+
+func TestNativeArthurMatchesMerlin(t *testing.T) {
+	io := "roundtrip\u0000A2scalars\u0000S1challenge\u0000A5bytes\u0000S2bytes challenge"
+	merlin, err := NewSkyscraperMerlin([]byte(io), false)
+	assert.Nil(t, err)
+	assert.Nil(t, merlin.AddScalars([]*big.Int{big.NewInt(7), big.NewInt(11)}))
+	merlinChallenge := make([]*big.Int, 1)
+	assert.Nil(t, merlin.ChallengeScalars(merlinChallenge))
+	assert.Nil(t, merlin.AddBytes([]byte("hello")))
+	merlinBytes := make([]byte, 20)
+	assert.Nil(t, merlin.ChallengeBytes(merlinBytes))
+
+	arthur, err := NewSkyscraperNativeArthur([]byte(io), merlin.Transcript(), false)
+	assert.Nil(t, err)
+	scalars := make([]*big.Int, 2)
+	assert.Nil(t, arthur.FillNextScalars(scalars))
+	assert.Equal(t, []*big.Int{big.NewInt(7), big.NewInt(11)}, scalars)
+	challenge := make([]*big.Int, 1)
+	assert.Nil(t, arthur.FillChallengeScalars(challenge))
+	assert.Equal(t, merlinChallenge, challenge)
+	bytes := make([]byte, 5)
+	assert.Nil(t, arthur.FillNextBytes(bytes))
+	assert.Equal(t, []byte("hello"), bytes)
+	challengeBytes := make([]byte, 20)
+	assert.Nil(t, arthur.FillChallengeBytes(challengeBytes))
+	assert.Equal(t, merlinBytes, challengeBytes)
+}
+
+func TestNativeArthurHint(t *testing.T) {
+	io := "hints\u0000Hfirst\u0000Hsecond"
+	transcript := []byte{2, 0, 0, 0, 7, 8, 3, 0, 0, 0, 1, 2}
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(io), transcript, false)
+	assert.Nil(t, err)
+	hint := make([]byte, 2)
+	assert.Nil(t, arthur.FillNextHint(hint))
+	assert.Equal(t, []byte{7, 8}, hint)
+	assert.ErrorContains(t, arthur.FillNextHint(make([]byte, 2)), "hint length mismatch")
+
+	arthur, err = NewKeccakNativeArthur(ecc.BN254.ScalarField(), []byte(io), transcript, false)
+	assert.Nil(t, err)
+	assert.Nil(t, arthur.FillNextHint(hint))
+	assert.ErrorContains(t, arthur.FillNextHint(make([]byte, 3)), "transcript too short")
+}
+
+// readTestData reads a file of testdata, produced by the Rust provers.
+func readTestData(t testing.TB, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.Nil(t, err)
+	return data
+}
+
+// TestNativeArthurConsecutiveSqueezes replays the Keccak WHIR transcript of
+// the example. Each round squeezes its STIR queries and then its PoW
+// challenge within one rate block, so the PoW nonces only verify if the
+// second squeeze continues where the first stopped, as in nimue. The last
+// two rounds of the example need fewer bits, so only the first three nonces
+// are checked against 16 bits.
+func TestNativeArthurConsecutiveSqueezes(t *testing.T) {
+	ioPattern := readTestData(t, "whir_keccak.iopattern")
+	arthur, err := NewKeccakNativeArthur(ecc.BN254.ScalarField(), ioPattern, readTestData(t, "whir_keccak.transcript"), false)
+	assert.Nil(t, err)
+	io := IOPattern{}
+	assert.Nil(t, io.Parse(ioPattern))
+	nonces := 0
+	for i := 0; i < len(io.Ops); i++ {
+		op := io.Ops[i]
+		switch {
+		case string(op.Label) == "pow_queries" && nonces < 3:
+			assert.Nil(t, VerifyPoW(arthur, Blake3PoW, 16), "nonce %d", nonces)
+			nonces++
+			i++ // the nonce
+		case op.Kind == Absorb:
+			assert.Nil(t, arthur.FillNextBytes(make([]byte, op.Size)))
+		case op.Kind == Squeeze:
+			assert.Nil(t, arthur.FillChallengeBytes(make([]byte, op.Size)))
+		}
+	}
+	assert.Equal(t, 3, nonces)
+	assert.Nil(t, arthur.Finish())
+}
@@ -0,0 +1,120 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
+	"github.com/reilabs/gnark-nimue/hash"
+	sha3native "golang.org/x/crypto/sha3"
+)
+
+// DigestKind selects the hash committing a transcript to a single field
+// element.
+type DigestKind uint8
+
+const (
+	// KeccakDigest is Keccak-256 of the transcript read as a big-endian
+	// integer and reduced modulo the native field, uint256(keccak256(t)) % p
+	// in Solidity.
+	KeccakDigest DigestKind = iota
+	// Poseidon2Digest absorbs the length of the transcript followed by the
+	// transcript packed as by PackTranscript into the Poseidon2 sponge, and
+	// squeezes one element. It is much cheaper in-circuit but only defined
+	// over BN254.
+	Poseidon2Digest
+)
+
+func (kind DigestKind) String() string {
+	switch kind {
+	case KeccakDigest:
+		return "KeccakDigest"
+	case Poseidon2Digest:
+		return "Poseidon2Digest"
+	}
+	return "Unknown"
+}
+
+// poseidon2DigestTag is the initial state of the Poseidon2 digest sponge.
+var poseidon2DigestTag = generateTag([]byte("gnark-nimue transcript digest"))
+
+// TranscriptDigest computes in-circuit the digest of the transcript.
+func TranscriptDigest(api frontend.API, kind DigestKind, transcript []uints.U8) (frontend.Variable, error) {
+	switch kind {
+	case KeccakDigest:
+		hasher, err := sha3.NewLegacyKeccak256(api)
+		if err != nil {
+			return nil, err
+		}
+		hasher.Write(transcript)
+		digest := frontend.Variable(0)
+		for _, b := range hasher.Sum() {
+			digest = api.Add(api.Mul(digest, 256), b.Val)
+		}
+		return digest, nil
+	case Poseidon2Digest:
+		if api.Compiler().Field().Cmp(ecc.BN254.ScalarField()) != 0 {
+			return nil, fmt.Errorf("%v is only defined over BN254", kind)
+		}
+		sponge, err := hash.NewPoseidon2(api)
+		if err != nil {
+			return nil, err
+		}
+		sponge.Initialize(poseidon2DigestTag)
+		// packing does not bound the bytes, so a prover could otherwise
+		// trade 256 in one byte for 1 in the next
+		checker := rangecheck.New(api)
+		for _, b := range transcript {
+			checker.Check(b.Val, 8)
+		}
+		input := []frontend.Variable{len(transcript)}
+		n := PackedBytesPerElement(api.Compiler().Field())
+		for i := 0; i < len(transcript); i += n {
+			chunk := transcript[i:min(i+n, len(transcript))]
+			packed := frontend.Variable(0)
+			for j := len(chunk) - 1; j >= 0; j-- {
+				packed = api.Add(api.Mul(packed, 256), chunk[j].Val)
+			}
+			input = append(input, packed)
+		}
+		sponge.Absorb(input)
+		out := make([]frontend.Variable, 1)
+		sponge.Squeeze(out)
+		return out[0], nil
+	}
+	return nil, fmt.Errorf("unknown digest kind %v", kind)
+}
+
+// NativeTranscriptDigest is the out-of-circuit counterpart of
+// TranscriptDigest for a circuit over the given field.
+func NativeTranscriptDigest(field *big.Int, kind DigestKind, transcript []byte) (*big.Int, error) {
+	switch kind {
+	case KeccakDigest:
+		hasher := sha3native.NewLegacyKeccak256()
+		hasher.Write(transcript)
+		digest := new(big.Int).SetBytes(hasher.Sum(nil))
+		return digest.Mod(digest, field), nil
+	case Poseidon2Digest:
+		if field.Cmp(ecc.BN254.ScalarField()) != 0 {
+			return nil, fmt.Errorf("%v is only defined over BN254", kind)
+		}
+		sponge := hash.NewNativePoseidon2()
+		sponge.Initialize(poseidon2DigestTag)
+		input := []fr.Element{fr.NewElement(uint64(len(transcript)))}
+		for _, packed := range PackTranscript(field, transcript) {
+			var element fr.Element
+			element.SetBigInt(packed)
+			input = append(input, element)
+		}
+		sponge.Absorb(input)
+		out := make([]fr.Element, 1)
+		sponge.Squeeze(out)
+		return out[0].BigInt(new(big.Int)), nil
+	}
+	return nil, fmt.Errorf("unknown digest kind %v", kind)
+}
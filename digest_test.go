@@ -0,0 +1,127 @@
+package gnark_nimue
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeKeccakDigest(t *testing.T) {
+	// keccak256("") reduced modulo the BN254 scalar field
+	expected, _ := new(big.Int).SetString("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", 16)
+	expected.Mod(expected, ecc.BN254.ScalarField())
+	digest, err := NativeTranscriptDigest(ecc.BN254.ScalarField(), KeccakDigest, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, digest)
+
+	_, err = NativeTranscriptDigest(ecc.BLS12_381.ScalarField(), Poseidon2Digest, nil)
+	assert.NotNil(t, err)
+}
+
+type digestCircuit struct {
+	Kind       DigestKind
+	Transcript [24]uints.U8
+	Digest     frontend.Variable `gnark:",public"`
+}
+
+func (circuit *digestCircuit) Define(api frontend.API) error {
+	arthur, err := NewKeccakArthur(api, []byte(badIOPat), circuit.Transcript[:], false, WithTranscriptDigest(circuit.Kind, circuit.Digest))
+	if err != nil {
+		return err
+	}
+	challenge := make([]uints.U8, 8)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	reply := make([]uints.U8, 8)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	challenge = make([]uints.U8, 16)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	reply = make([]uints.U8, 16)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+type rawDigestCircuit struct {
+	Kind       DigestKind
+	Transcript []uints.U8
+	Digest     frontend.Variable
+}
+
+func (circuit *rawDigestCircuit) Define(api frontend.API) error {
+	digest, err := TranscriptDigest(api, circuit.Kind, circuit.Transcript)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(digest, circuit.Digest)
+	return nil
+}
+
+func checkTranscriptDigest(t *testing.T, kind DigestKind) {
+	// several Keccak blocks and Poseidon2 chunks
+	long := make([]byte, 200)
+	for i := range long {
+		long[i] = byte(7 * i)
+	}
+	longDigest, err := NativeTranscriptDigest(ecc.BN254.ScalarField(), kind, long)
+	assert.Nil(t, err)
+	assert.Nil(t, test.IsSolved(
+		&rawDigestCircuit{Kind: kind, Transcript: make([]uints.U8, len(long))},
+		&rawDigestCircuit{Kind: kind, Transcript: uints.NewU8Array(long), Digest: longDigest},
+		ecc.BN254.ScalarField()))
+
+	digest, err := NativeTranscriptDigest(ecc.BN254.ScalarField(), kind, badTranscript)
+	assert.Nil(t, err)
+
+	circuit := digestCircuit{Kind: kind}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	assert.Nil(t, err)
+	// the constant one wire and the digest
+	assert.Equal(t, 2, ccs.GetNbPublicVariables())
+
+	assignment := digestCircuit{Kind: kind, Transcript: [24]uints.U8(uints.NewU8Array(badTranscript)), Digest: digest}
+	assert.Nil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+
+	assignment.Digest = new(big.Int).Add(digest, big.NewInt(1))
+	assert.NotNil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+}
+
+func TestForgedTranscriptDigest(t *testing.T) {
+	honest := []byte{1, 2, 3, 4}
+	// packs like honest with the first two bytes read little-endian, but
+	// Arthur would read 257 and 1
+	forged := uints.NewU8Array(honest)
+	forged[0] = uints.U8{Val: 257}
+	forged[1] = uints.U8{Val: 1}
+	for _, kind := range []DigestKind{KeccakDigest, Poseidon2Digest} {
+		digest, err := NativeTranscriptDigest(ecc.BN254.ScalarField(), kind, honest)
+		assert.Nil(t, err)
+		circuit := rawDigestCircuit{Kind: kind, Transcript: make([]uints.U8, len(honest))}
+		assert.Nil(t, test.IsSolved(&circuit, &rawDigestCircuit{Kind: kind, Transcript: uints.NewU8Array(honest), Digest: digest}, ecc.BN254.ScalarField()), kind)
+		assert.NotNil(t, test.IsSolved(&circuit, &rawDigestCircuit{Kind: kind, Transcript: forged, Digest: digest}, ecc.BN254.ScalarField()), kind)
+	}
+}
+
+func TestKeccakTranscriptDigest(t *testing.T) {
+	checkTranscriptDigest(t, KeccakDigest)
+}
+
+func TestPoseidon2TranscriptDigest(t *testing.T) {
+	checkTranscriptDigest(t, Poseidon2Digest)
+}
@@ -0,0 +1,78 @@
+package gnark_nimue
+
+import (
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// emulatedFromBytes packs bytes into an element of the emulated field. The
+// value is built from little-endian bytes when le is set and big-endian bytes
+// otherwise, and is reduced modulo the emulated modulus.
+func emulatedFromBytes[T emulated.FieldParams](api frontend.API, field *emulated.Field[T], bytes []uints.U8, le bool) *emulated.Element[T] {
+	var params T
+	leBits := make([]frontend.Variable, 0, 8*len(bytes))
+	for i := range bytes {
+		b := bytes[i]
+		if !le {
+			b = bytes[len(bytes)-1-i]
+		}
+		leBits = append(leBits, bits.ToBinary(api, b.Val, bits.WithNbDigits(8))...)
+	}
+
+	// FromBits only accepts as many bits as fit in the limbs, so longer
+	// inputs are split into chunks and recombined with constant shifts.
+	chunkSize := int(params.NbLimbs()*params.BitsPerLimb()) - 1
+	result := field.FromBits(leBits[:min(chunkSize, len(leBits))]...)
+	shift := big.NewInt(1)
+	for start := chunkSize; start < len(leBits); start += chunkSize {
+		shift = new(big.Int).Lsh(shift, uint(chunkSize))
+		shift.Mod(shift, params.Modulus())
+		chunk := field.FromBits(leBits[start:min(start+chunkSize, len(leBits))]...)
+		result = field.Add(result, field.Mul(chunk, field.NewElement(shift)))
+	}
+	return field.Reduce(result)
+}
+
+// FillNextEmulatedScalars reads elements of the emulated field T from the
+// transcript. Like nimue, each scalar is encoded in (bits+7)/8 little-endian
+// bytes which are absorbed as regular bytes. With WithStrictScalars the
+// encodings must be less than the emulated modulus.
+func FillNextEmulatedScalars[T emulated.FieldParams](api frontend.API, arthur Arthur, field *emulated.Field[T], out []*emulated.Element[T]) error {
+	var params T
+	strict := false
+	if arthur, ok := arthur.(strictArthur); ok {
+		strict = arthur.strictScalars()
+	}
+	bytes := make([]uints.U8, (params.Modulus().BitLen()+7)/8)
+	for i := range out {
+		err := arthur.FillNextBytes(bytes)
+		if err != nil {
+			return err
+		}
+		if strict {
+			assertCanonical(api, bytes, params.Modulus())
+		}
+		out[i] = emulatedFromBytes(api, field, bytes, true)
+	}
+	return nil
+}
+
+// FillChallengeEmulatedScalars squeezes elements of the emulated field T. Like
+// nimue, each challenge is (bits+128)/8 big-endian bytes reduced modulo the
+// emulated modulus.
+func FillChallengeEmulatedScalars[T emulated.FieldParams](api frontend.API, arthur Arthur, field *emulated.Field[T], out []*emulated.Element[T]) error {
+	var params T
+	bytes := make([]uints.U8, (params.Modulus().BitLen()+128)/8)
+	for i := range out {
+		err := arthur.FillChallengeBytes(bytes)
+		if err != nil {
+			return err
+		}
+		out[i] = emulatedFromBytes(api, field, bytes, false)
+	}
+	return nil
+}
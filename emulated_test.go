@@ -0,0 +1,173 @@
+package gnark_nimue
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+type emulatedCircuit struct {
+	IO            []byte
+	UseSkyscraper bool
+	Transcript    []uints.U8
+	Scalars       []emulated.Element[emulated.BLS12381Fr]
+	Challenges    []emulated.Element[emulated.BLS12381Fr]
+}
+
+func (circuit *emulatedCircuit) Define(api frontend.API) error {
+	var arthur Arthur
+	var err error
+	if circuit.UseSkyscraper {
+		arthur, err = NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), circuit.IO, circuit.Transcript, false)
+	} else {
+		arthur, err = NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+	}
+	if err != nil {
+		return err
+	}
+	field, err := emulated.NewField[emulated.BLS12381Fr](api)
+	if err != nil {
+		return err
+	}
+
+	scalars := make([]*emulated.Element[emulated.BLS12381Fr], len(circuit.Scalars))
+	err = FillNextEmulatedScalars(api, arthur, field, scalars)
+	if err != nil {
+		return err
+	}
+	for i := range scalars {
+		field.AssertIsEqual(scalars[i], &circuit.Scalars[i])
+	}
+	challenges := make([]*emulated.Element[emulated.BLS12381Fr], len(circuit.Challenges))
+	err = FillChallengeEmulatedScalars(api, arthur, field, challenges)
+	if err != nil {
+		return err
+	}
+	for i := range challenges {
+		field.AssertIsEqual(challenges[i], &circuit.Challenges[i])
+	}
+	return arthur.Finish()
+}
+
+func checkEmulatedScalars(t *testing.T, io string, useSkyscraper bool) {
+	var merlin Merlin
+	var err error
+	if useSkyscraper {
+		merlin, err = NewSkyscraperMerlin([]byte(io), false)
+	} else {
+		merlin, err = NewKeccakMerlin(ecc.BN254.ScalarField(), []byte(io), false)
+	}
+	assert.Nil(t, err)
+
+	modulus := ecc.BLS12_381.ScalarField()
+	scalars := []*big.Int{big.NewInt(3), new(big.Int).Sub(modulus, big.NewInt(1))}
+	assert.Nil(t, AddEmulatedScalars(merlin, modulus, scalars))
+	challenges := make([]*big.Int, 2)
+	assert.Nil(t, ChallengeEmulatedScalars(merlin, modulus, challenges))
+
+	circuit := emulatedCircuit{
+		IO:            []byte(io),
+		UseSkyscraper: useSkyscraper,
+		Transcript:    make([]uints.U8, len(merlin.Transcript())),
+		Scalars:       make([]emulated.Element[emulated.BLS12381Fr], len(scalars)),
+		Challenges:    make([]emulated.Element[emulated.BLS12381Fr], len(challenges)),
+	}
+	assignment := emulatedCircuit{
+		IO:            []byte(io),
+		UseSkyscraper: useSkyscraper,
+		Transcript:    uints.NewU8Array(merlin.Transcript()),
+	}
+	for _, s := range scalars {
+		assignment.Scalars = append(assignment.Scalars, emulated.ValueOf[emulated.BLS12381Fr](s))
+	}
+	for _, c := range challenges {
+		assignment.Challenges = append(assignment.Challenges, emulated.ValueOf[emulated.BLS12381Fr](c))
+	}
+	assert.Nil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+}
+
+func TestKeccakEmulatedScalars(t *testing.T) {
+	checkEmulatedScalars(t, "emulated\u0000A64scalars\u0000S94challenges", false)
+}
+
+func TestSkyscraperEmulatedScalars(t *testing.T) {
+	// bytes are absorbed one field element each and 47 challenge bytes take
+	// four squeezes of 15 bytes
+	checkEmulatedScalars(t, "emulated\u0000A64scalars\u0000S8challenges", true)
+}
+
+type strictEmulatedCircuit struct {
+	UseSkyscraper bool
+	Strict        bool
+	Transcript    []uints.U8
+	Scalar        emulated.Element[emulated.BLS12381Fr]
+}
+
+func (circuit *strictEmulatedCircuit) Define(api frontend.API) error {
+	var opts []ArthurOption
+	if circuit.Strict {
+		opts = append(opts, WithStrictScalars())
+	}
+	io := []byte("strict\u0000A32scalar\u0000S1challenge")
+	var arthur Arthur
+	var err error
+	if circuit.UseSkyscraper {
+		arthur, err = NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), io, circuit.Transcript, false, opts...)
+	} else {
+		arthur, err = NewKeccakArthur(api, io, circuit.Transcript, false, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	field, err := emulated.NewField[emulated.BLS12381Fr](api)
+	if err != nil {
+		return err
+	}
+	scalar := make([]*emulated.Element[emulated.BLS12381Fr], 1)
+	err = FillNextEmulatedScalars(api, arthur, field, scalar)
+	if err != nil {
+		return err
+	}
+	field.AssertIsEqual(scalar[0], &circuit.Scalar)
+	err = arthur.FillChallengeBytes(make([]uints.U8, 1))
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+func TestStrictEmulatedScalars(t *testing.T) {
+	modulus := ecc.BLS12_381.ScalarField()
+	encode := func(v *big.Int) []uints.U8 {
+		bytes := make([]byte, 32)
+		v.FillBytes(bytes)
+		slices.Reverse(bytes)
+		return uints.NewU8Array(bytes)
+	}
+	check := func(useSkyscraper, strict bool, encoded *big.Int) error {
+		circuit := strictEmulatedCircuit{UseSkyscraper: useSkyscraper, Strict: strict, Transcript: make([]uints.U8, 32)}
+		assignment := strictEmulatedCircuit{
+			UseSkyscraper: useSkyscraper,
+			Strict:        strict,
+			Transcript:    encode(encoded),
+			Scalar:        emulated.ValueOf[emulated.BLS12381Fr](3),
+		}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	// 3 + r still fits in 32 bytes and reduces to 3
+	nonCanonical := new(big.Int).Add(modulus, big.NewInt(3))
+	for _, useSkyscraper := range []bool{false, true} {
+		assert.Nil(t, check(useSkyscraper, false, big.NewInt(3)))
+		assert.Nil(t, check(useSkyscraper, true, big.NewInt(3)))
+		assert.Nil(t, check(useSkyscraper, false, nonCanonical))
+		assert.NotNil(t, check(useSkyscraper, true, nonCanonical))
+	}
+}
@@ -9,16 +9,18 @@ import (
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 	"github.com/consensys/gnark/std/math/uints"
 	gnark_nimue "github.com/reilabs/gnark-nimue"
+	"github.com/reilabs/gnark-nimue/sumcheck"
 	skyscraper "github.com/reilabs/gnark-skyscraper"
 )
 
 type TestCircuit struct {
 	IO         []byte
-	Transcript [24]uints.U8 `gnark:",public"`
+	Transcript [24]uints.U8
+	Digest     frontend.Variable `gnark:",public"`
 }
 
 func (circuit *TestCircuit) Define(api frontend.API) error {
-	arthur, err := gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript[:], false)
+	arthur, err := gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript[:], false, gnark_nimue.WithTranscriptDigest(gnark_nimue.KeccakDigest, circuit.Digest))
 
 	if err != nil {
 		return err
@@ -73,9 +75,12 @@ func Example1() {
 
 	transcript := [24]uints.U8(uints.NewU8Array(transcriptBytes[:]))
 
+	digest, _ := gnark_nimue.NativeTranscriptDigest(ecc.BN254.ScalarField(), gnark_nimue.KeccakDigest, transcriptBytes)
+
 	assignment := TestCircuit{
 		IO:         []byte(badIOPat),
 		Transcript: transcript,
+		Digest:     digest,
 	}
 
 	witness, _ := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
@@ -88,11 +93,12 @@ func Example1() {
 
 type WhirCircuit struct {
 	IO         []byte
-	Transcript [2312]uints.U8 `gnark:",public"`
+	Transcript [2312]uints.U8
+	Digest     frontend.Variable `gnark:",public"`
 }
 
 func (circuit *WhirCircuit) Define(api frontend.API) error {
-	arthur, err := gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript[:], false)
+	arthur, err := gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript[:], false, gnark_nimue.WithTranscriptDigest(gnark_nimue.KeccakDigest, circuit.Digest))
 	if err != nil {
 		return err
 	}
@@ -129,21 +135,13 @@ func (circuit *WhirCircuit) Define(api frontend.API) error {
 	}
 	api.Println(initialCombinationRandomness[0])
 
-	for range 4 {
-		sumcheckPolyEvals := [3]frontend.Variable{}
-		err = arthur.FillNextScalars(sumcheckPolyEvals[:])
-		if err != nil {
-			return err
-		}
-		api.Println(sumcheckPolyEvals[:]...)
-
-		foldingRandomnessSingle := [1]frontend.Variable{}
-		err = arthur.FillChallengeScalars(foldingRandomnessSingle[:])
-		if err != nil {
-			return err
-		}
-		api.Println(foldingRandomnessSingle[0])
+	// the statement is empty, so the initial claim is the OOD answer
+	claim, foldingRandomness, err := sumcheck.Verify(api, arthur, sumcheck.Config{Degree: 2, Rounds: 4, Form: sumcheck.Evaluations}, oodAns[0])
+	if err != nil {
+		return err
 	}
+	api.Println(claim)
+	api.Println(foldingRandomness...)
 
 	return nil
 }
@@ -173,9 +171,12 @@ func ExampleWhir() {
 		transcript[i] = uints.NewU8(transcriptBytes[i])
 	}
 
+	digest, _ := gnark_nimue.NativeTranscriptDigest(ecc.BN254.ScalarField(), gnark_nimue.KeccakDigest, transcriptBytes[:])
+
 	assignment := WhirCircuit{
 		IO:         []byte(ioPat),
 		Transcript: transcript,
+		Digest:     digest,
 	}
 
 	witness, _ := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
@@ -188,12 +189,13 @@ func ExampleWhir() {
 
 type WhirSkyscraperCircuit struct {
 	IO         []byte
-	Transcript [2312]uints.U8 `gnark:",public"`
+	Transcript [2312]uints.U8
+	Digest     frontend.Variable `gnark:",public"`
 }
 
 func (circuit *WhirSkyscraperCircuit) Define(api frontend.API) error {
 	sc := skyscraper.NewSkyscraper(api, 2)
-	arthur, err := gnark_nimue.NewSkyscraperArthur(api, sc, circuit.IO, circuit.Transcript[:], false)
+	arthur, err := gnark_nimue.NewSkyscraperArthur(api, sc, circuit.IO, circuit.Transcript[:], false, gnark_nimue.WithTranscriptDigest(gnark_nimue.Poseidon2Digest, circuit.Digest))
 	if err != nil {
 		return err
 	}
@@ -268,9 +270,12 @@ func ExampleWhirSkyScraper() {
 		transcript[i] = uints.NewU8(transcriptBytes[i])
 	}
 
+	digest, _ := gnark_nimue.NativeTranscriptDigest(ecc.BN254.ScalarField(), gnark_nimue.Poseidon2Digest, transcriptBytes[:])
+
 	assignment := WhirSkyscraperCircuit{
 		IO:         []byte(ioPat),
 		Transcript: transcript,
+		Digest:     digest,
 	}
 
 	witness, _ := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
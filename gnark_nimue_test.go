@@ -7,7 +7,12 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/reilabs/gnark-nimue/hash"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
 	"github.com/stretchr/testify/assert"
+	"math/big"
+	"slices"
 	"testing"
 )
 
@@ -81,3 +86,327 @@ func TestEndToEnd(t *testing.T) {
 	assert.Nil(t, vErr)
 
 }
+
+type finishCircuit struct {
+	IO         []byte
+	Reads      int
+	Transcript []uints.U8
+}
+
+func (circuit *finishCircuit) Define(api frontend.API) error {
+	arthur, err := NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+	if err != nil {
+		return err
+	}
+	for range circuit.Reads {
+		err = arthur.FillNextBytes(make([]uints.U8, 4))
+		if err != nil {
+			return err
+		}
+	}
+	return arthur.Finish()
+}
+
+func TestFinish(t *testing.T) {
+	io := []byte("finish\u0000A8bytes")
+	check := func(reads, transcriptLen int) error {
+		transcript := uints.NewU8Array(make([]byte, transcriptLen))
+		circuit := finishCircuit{IO: io, Reads: reads, Transcript: make([]uints.U8, transcriptLen)}
+		assignment := finishCircuit{IO: io, Reads: reads, Transcript: transcript}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	assert.Nil(t, check(2, 8))
+	assert.ErrorContains(t, check(1, 8), "unconsumed Absorb 4 bytes")
+	assert.ErrorContains(t, check(2, 9), "transcript has 1 unread bytes")
+	assert.ErrorContains(t, check(2, 6), "transcript too short: need 4 bytes, have 2")
+}
+
+// counterSponge squeezes value, value - 1, value - 2, ..., which makes the
+// bytes derived from each squeezed element easy to predict.
+type counterSponge struct {
+	value *big.Int
+	count int64
+}
+
+func (s *counterSponge) Initialize(iv [32]byte) {}
+
+func (s *counterSponge) Absorb(data []frontend.Variable) {}
+
+func (s *counterSponge) Squeeze(out []frontend.Variable) {
+	for i := range out {
+		out[i] = new(big.Int).Sub(s.value, big.NewInt(s.count))
+		s.count++
+	}
+}
+
+func (s *counterSponge) Ratchet() {}
+
+func (s *counterSponge) PrintState(api frontend.API) {}
+
+type challengeBytesCircuit struct {
+	IO       []byte
+	Value    *big.Int
+	Expected []frontend.Variable
+}
+
+func (circuit *challengeBytesCircuit) Define(api frontend.API) error {
+	safe, err := NewSafe[frontend.Variable, *counterSponge](&counterSponge{value: circuit.Value}, circuit.IO, false)
+	if err != nil {
+		return err
+	}
+	arthur := &nativeArthur[*counterSponge]{api, nil, safe, arthurConfig{}}
+	out := make([]uints.U8, len(circuit.Expected))
+	err = arthur.FillChallengeBytes(out)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		api.AssertIsEqual(out[i].Val, circuit.Expected[i])
+	}
+	return arthur.Finish()
+}
+
+func TestRandomBytesInField(t *testing.T) {
+	fromHex := func(s string) *big.Int {
+		v, ok := new(big.Int).SetString(s, 16)
+		assert.True(t, ok)
+		return v
+	}
+	pow2 := func(n uint) *big.Int {
+		return new(big.Int).Lsh(big.NewInt(1), n)
+	}
+	cases := []struct {
+		name            string
+		field           *big.Int
+		numBits, nBytes int
+	}{
+		{"BN254", ecc.BN254.ScalarField(), 126, 15},
+		{"BLS12-377", ecc.BLS12_377.ScalarField(), 125, 15},
+		{"BLS12-381", ecc.BLS12_381.ScalarField(), 127, 15},
+		{"BW6-761", ecc.BW6_761.ScalarField(), 249, 31},
+		{"secp256k1", fromHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"), 128, 16},
+		// close to a power of two, almost every bit is uniform
+		{"2^255-19", new(big.Int).Sub(pow2(255), big.NewInt(19)), 255, 31},
+		{"2^256-189", new(big.Int).Sub(pow2(256), big.NewInt(189)), 256, 32},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.numBits, randomBitsInField(c.field), c.name)
+		n, err := randomBytesInField(c.field)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.nBytes, n, c.name)
+	}
+
+	goldilocks := new(big.Int).Add(new(big.Int).Sub(pow2(64), pow2(32)), big.NewInt(1))
+	assert.Equal(t, 0, randomBitsInField(goldilocks))
+	_, err := randomBytesInField(goldilocks)
+	assert.ErrorContains(t, err, "field of 64 bits is too small")
+}
+
+func TestNativeChallengeBytesAllCurves(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_377, ecc.BLS12_381, ecc.BW6_761} {
+		field := curve.ScalarField()
+		numBytes, err := randomBytesInField(field)
+		assert.Nil(t, err)
+
+		// 40 bytes need ceil(40 / numBytes) squeezed elements, each
+		// contributing its numBytes least significant bytes
+		outLen := 40
+		squeezes := (outLen + numBytes - 1) / numBytes
+		io := []byte(fmt.Sprintf("bytes\u0000S%dchallenge", squeezes))
+		value := new(big.Int).Sub(field, big.NewInt(2))
+		expected := make([]frontend.Variable, 0, outLen)
+		for i := 0; len(expected) < outLen; i++ {
+			le := new(big.Int).Sub(value, big.NewInt(int64(i))).FillBytes(make([]byte, (field.BitLen()+7)/8))
+			slices.Reverse(le)
+			for _, b := range le[:min(numBytes, outLen-len(expected))] {
+				expected = append(expected, b)
+			}
+		}
+		circuit := challengeBytesCircuit{IO: io, Value: value, Expected: make([]frontend.Variable, outLen)}
+		assignment := challengeBytesCircuit{IO: io, Value: value, Expected: expected}
+		assert.Nil(t, test.IsSolved(&circuit, &assignment, field), curve.String())
+	}
+}
+
+type strictScalarCircuit struct {
+	UseSkyscraper bool
+	Strict        bool
+	Transcript    []uints.U8
+	Scalar        frontend.Variable
+}
+
+func (circuit *strictScalarCircuit) Define(api frontend.API) error {
+	// skyscraper needs at least one permutation, hence the challenge
+	io := []byte("strict\u0000A1scalar\u0000S1challenge")
+	var opts []ArthurOption
+	if circuit.Strict {
+		opts = append(opts, WithStrictScalars())
+	}
+	var arthur Arthur
+	var err error
+	if circuit.UseSkyscraper {
+		arthur, err = NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), io, circuit.Transcript, false, opts...)
+	} else {
+		io = []byte("strict\u0000A32scalar\u0000S1challenge")
+		arthur, err = NewKeccakArthur(api, io, circuit.Transcript, false, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	scalar := make([]frontend.Variable, 1)
+	err = arthur.FillNextScalars(scalar)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(scalar[0], circuit.Scalar)
+	err = arthur.FillChallengeBytes(make([]uints.U8, 1))
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+func TestStrictScalars(t *testing.T) {
+	modulus := ecc.BN254.ScalarField()
+	encode := func(v *big.Int) []byte {
+		bytes := make([]byte, 32)
+		v.FillBytes(bytes)
+		slices.Reverse(bytes)
+		return bytes
+	}
+	check := func(useSkyscraper, strict bool, encoded, scalar *big.Int) error {
+		circuit := strictScalarCircuit{UseSkyscraper: useSkyscraper, Strict: strict, Transcript: make([]uints.U8, 32)}
+		assignment := strictScalarCircuit{
+			UseSkyscraper: useSkyscraper,
+			Strict:        strict,
+			Transcript:    uints.NewU8Array(encode(encoded)),
+			Scalar:        scalar,
+		}
+		return test.IsSolved(&circuit, &assignment, modulus)
+	}
+	maxScalar := new(big.Int).Sub(modulus, big.NewInt(1))
+	for _, useSkyscraper := range []bool{false, true} {
+		assert.Nil(t, check(useSkyscraper, true, maxScalar, maxScalar))
+		// the modulus itself wraps around to zero
+		assert.Nil(t, check(useSkyscraper, false, modulus, big.NewInt(0)))
+		assert.NotNil(t, check(useSkyscraper, true, modulus, big.NewInt(0)))
+
+		constraints := make([]int, 2)
+		for i, strict := range []bool{false, true} {
+			circuit := strictScalarCircuit{UseSkyscraper: useSkyscraper, Strict: strict, Transcript: make([]uints.U8, 32)}
+			ccs, err := frontend.Compile(modulus, r1cs.NewBuilder, &circuit)
+			assert.Nil(t, err)
+			constraints[i] = ccs.GetNbConstraints()
+		}
+		t.Logf("skyscraper=%v: strict scalars add %d R1CS constraints per scalar", useSkyscraper, constraints[1]-constraints[0])
+	}
+}
+
+func TestNativeSafe(t *testing.T) {
+	safe, err := NewSafe[byte, hash.NativeKeccak](hash.NewNativeKeccak(), []byte(badIOPat), false)
+	assert.Nil(t, err)
+	challenge := make([]byte, 8)
+	assert.Nil(t, safe.Squeeze(challenge))
+	assert.Equal(t, badTranscript[:8], challenge)
+}
+
+type fillBytesCircuit struct {
+	IO         []byte
+	PerByte    bool
+	Transcript []uints.U8
+	Challenge  frontend.Variable
+}
+
+func (circuit *fillBytesCircuit) Define(api frontend.API) error {
+	arthur, err := NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), circuit.IO, circuit.Transcript, false)
+	if err != nil {
+		return err
+	}
+	bytes := make([]uints.U8, len(circuit.Transcript))
+	if circuit.PerByte {
+		for i := range bytes {
+			err = arthur.FillNextBytes(bytes[i : i+1])
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err = arthur.FillNextBytes(bytes)
+		if err != nil {
+			return err
+		}
+	}
+	challenge := make([]frontend.Variable, 1)
+	err = arthur.FillChallengeScalars(challenge)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(challenge[0], circuit.Challenge)
+	return arthur.Finish()
+}
+
+func fillBytesIOPattern(t testing.TB, n int) []byte {
+	return buildIO(t, NewIOPattern("fill bytes").WithCodec(FieldCodec(ecc.BN254.ScalarField())).
+		AbsorbBytes(n, "transcript").
+		SqueezeScalars(1, "challenge"))
+}
+
+func TestNativeFillNextBytes(t *testing.T) {
+	transcript := make([]byte, 100)
+	for i := range transcript {
+		transcript[i] = byte(31 * i)
+	}
+	io := fillBytesIOPattern(t, len(transcript))
+	merlin, err := NewSkyscraperMerlin(io, false)
+	assert.Nil(t, err)
+	assert.Nil(t, merlin.AddBytes(transcript))
+	challenge := []*big.Int{new(big.Int)}
+	assert.Nil(t, merlin.ChallengeScalars(challenge))
+
+	var constraints [2]int
+	for i, perByte := range []bool{false, true} {
+		circuit := fillBytesCircuit{IO: io, PerByte: perByte, Transcript: make([]uints.U8, len(transcript))}
+		assignment := fillBytesCircuit{IO: io, PerByte: perByte, Transcript: uints.NewU8Array(transcript), Challenge: challenge[0]}
+		assert.Nil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+		assert.Nil(t, err)
+		constraints[i] = ccs.GetNbConstraints()
+	}
+	// absorbing in one call or byte by byte is the same sponge computation
+	assert.Equal(t, constraints[0], constraints[1])
+}
+
+// BenchmarkNativeFillNextBytes compiles the absorption of the Skyscraper
+// WHIR transcript of the example with a single FillNextBytes call and with one
+// call per byte, which is what FillNextBytes used to do internally.
+func BenchmarkNativeFillNextBytes(b *testing.B) {
+	transcript := readTestData(b, "whir_skyscraper.transcript")
+	io := fillBytesIOPattern(b, len(transcript))
+	merlin, err := NewSkyscraperMerlin(io, false)
+	assert.Nil(b, err)
+	assert.Nil(b, merlin.AddBytes(transcript))
+	challenge := []*big.Int{new(big.Int)}
+	assert.Nil(b, merlin.ChallengeScalars(challenge))
+
+	for _, perByte := range []bool{false, true} {
+		name := "Batched"
+		if perByte {
+			name = "PerByte"
+		}
+		b.Run(name, func(b *testing.B) {
+			circuit := fillBytesCircuit{IO: io, PerByte: perByte, Transcript: make([]uints.U8, len(transcript))}
+			assignment := fillBytesCircuit{IO: io, PerByte: perByte, Transcript: uints.NewU8Array(transcript), Challenge: challenge[0]}
+			assert.Nil(b, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+			b.ResetTimer()
+			var constraints int
+			for range b.N {
+				ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+				if err != nil {
+					b.Fatal(err)
+				}
+				constraints = ccs.GetNbConstraints()
+			}
+			b.ReportMetric(float64(constraints), "constraints")
+		})
+	}
+}
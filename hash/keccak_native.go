@@ -0,0 +1,72 @@
+package hash
+
+import (
+	"github.com/consensys/gnark/frontend"
+	_ "golang.org/x/crypto/sha3"
+	_ "unsafe"
+)
+
+//go:linkname keccakF1600 golang.org/x/crypto/sha3.keccakF1600
+func keccakF1600(a *[25]uint64)
+
+// KeccakF applies the Keccak-f[1600] permutation to a byte-oriented state,
+// using the same little-endian lane layout as KeccakState.
+func KeccakF(a *[200]byte) {
+	b := [25]uint64{}
+	for i := 0; i < 25; i++ {
+		for j := 0; j < 8; j++ {
+			b[i] |= uint64(a[i*8+j]) << uint(j*8)
+		}
+	}
+	keccakF1600(&b)
+	for i := 0; i < 25; i++ {
+		for j := 0; j < 8; j++ {
+			a[i*8+j] = byte(b[i] >> uint(j*8))
+		}
+	}
+}
+
+// NativeKeccakState is the out-of-circuit counterpart of KeccakState.
+type NativeKeccakState struct {
+	state [200]byte
+}
+
+func (k *NativeKeccakState) N() int {
+	return 200
+}
+
+func (k *NativeKeccakState) R() int {
+	return 136
+}
+
+func (k *NativeKeccakState) Initialize(iv [32]byte) {
+	copy(k.state[k.R():], iv[:])
+}
+
+func (k *NativeKeccakState) Permute() {
+	KeccakF(&k.state)
+}
+
+func (k *NativeKeccakState) State() []byte {
+	return k.state[:]
+}
+
+func (k *NativeKeccakState) Zeroize(index int) {
+	k.state[index] = 0
+}
+
+func (k *NativeKeccakState) PrintState(api frontend.API) {
+	vars := make([]frontend.Variable, len(k.state))
+	for i, s := range k.state {
+		vars[i] = s
+	}
+	api.Println(vars...)
+}
+
+type NativeKeccak DuplexHash[byte]
+
+func NewNativeKeccak() NativeKeccak {
+	return &DuplexSponge[byte, *NativeKeccakState]{
+		sponge: &NativeKeccakState{},
+	}
+}
@@ -0,0 +1,208 @@
+package hash
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+// Poseidon2 sponge parameters: a width-3 state with rate 2 and the BN254
+// instance of the HorizenLabs reference implementation, with S-box x^5, the
+// external matrix circ(2, 1, 1) and the internal matrix diag(1, 1, 2) plus the
+// all-ones matrix. gnark's std permutation has the same rounds but derives
+// other round constants, so it cannot verify transcripts of Rust provers.
+const (
+	Poseidon2Width         = 3
+	Poseidon2FullRounds    = 8
+	Poseidon2PartialRounds = 56
+	poseidon2Rate          = Poseidon2Width - 1
+)
+
+// poseidon2Constants are poseidon2RoundConstants as field elements.
+var poseidon2Constants = func() (constants [Poseidon2FullRounds + Poseidon2PartialRounds][Poseidon2Width]fr.Element) {
+	for i, round := range poseidon2RoundConstants {
+		for j, c := range round {
+			if _, err := constants[i][j].SetString(c); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return
+}()
+
+// isPoseidon2FullRound reports whether round applies the S-box to the whole
+// state. Half of the full rounds come before the partial rounds.
+func isPoseidon2FullRound(round int) bool {
+	return round < Poseidon2FullRounds/2 || round >= Poseidon2FullRounds/2+Poseidon2PartialRounds
+}
+
+type Poseidon2State struct {
+	api frontend.API
+	s   [Poseidon2Width]frontend.Variable
+}
+
+func (s *Poseidon2State) N() int {
+	return Poseidon2Width
+}
+
+func (s *Poseidon2State) R() int {
+	return poseidon2Rate
+}
+
+func (s *Poseidon2State) Initialize(iv [32]byte) {
+	slices.Reverse(iv[:])
+	for i := range s.s {
+		s.s[i] = 0
+	}
+	s.s[poseidon2Rate] = new(big.Int).SetBytes(iv[:])
+}
+
+func (s *Poseidon2State) sBox(i int) {
+	square := s.api.Mul(s.s[i], s.s[i])
+	s.s[i] = s.api.Mul(s.api.Mul(square, square), s.s[i])
+}
+
+func (s *Poseidon2State) matMulExternal() {
+	sum := s.api.Add(s.s[0], s.s[1], s.s[2])
+	for i := range s.s {
+		s.s[i] = s.api.Add(s.s[i], sum)
+	}
+}
+
+func (s *Poseidon2State) matMulInternal() {
+	sum := s.api.Add(s.s[0], s.s[1], s.s[2])
+	s.s[0] = s.api.Add(s.s[0], sum)
+	s.s[1] = s.api.Add(s.s[1], sum)
+	s.s[2] = s.api.Add(s.api.Mul(s.s[2], 2), sum)
+}
+
+func (s *Poseidon2State) Permute() {
+	s.matMulExternal()
+	for round := range poseidon2Constants {
+		if isPoseidon2FullRound(round) {
+			for i := range s.s {
+				s.s[i] = s.api.Add(s.s[i], poseidon2Constants[round][i].String())
+				s.sBox(i)
+			}
+			s.matMulExternal()
+		} else {
+			s.s[0] = s.api.Add(s.s[0], poseidon2Constants[round][0].String())
+			s.sBox(0)
+			s.matMulInternal()
+		}
+	}
+}
+
+func (s *Poseidon2State) State() []frontend.Variable {
+	return s.s[:]
+}
+
+func (s *Poseidon2State) Zeroize(index int) {
+	s.s[index] = 0
+}
+
+func (s *Poseidon2State) PrintState(api frontend.API) {
+	api.Println(s.s[:]...)
+}
+
+type Poseidon2 DuplexHash[frontend.Variable]
+
+// NewPoseidon2 creates the sponge in a circuit over BN254, the only field the
+// round constants are defined for.
+func NewPoseidon2(api frontend.API) (Poseidon2, error) {
+	if api.Compiler().Field().Cmp(ecc.BN254.ScalarField()) != 0 {
+		return nil, fmt.Errorf("Poseidon2 is only defined over BN254, not %s", api.Compiler().Field())
+	}
+	return &DuplexSponge[frontend.Variable, *Poseidon2State]{
+		sponge: &Poseidon2State{api: api},
+	}, nil
+}
+
+// NativePoseidon2State is the out-of-circuit counterpart of Poseidon2State.
+type NativePoseidon2State struct {
+	s [Poseidon2Width]fr.Element
+}
+
+func (s *NativePoseidon2State) N() int {
+	return Poseidon2Width
+}
+
+func (s *NativePoseidon2State) R() int {
+	return poseidon2Rate
+}
+
+func (s *NativePoseidon2State) Initialize(iv [32]byte) {
+	slices.Reverse(iv[:])
+	for i := range s.s {
+		s.s[i].SetZero()
+	}
+	s.s[poseidon2Rate].SetBigInt(new(big.Int).SetBytes(iv[:]))
+}
+
+func (s *NativePoseidon2State) sBox(i int) {
+	var square fr.Element
+	square.Square(&s.s[i])
+	square.Square(&square)
+	s.s[i].Mul(&s.s[i], &square)
+}
+
+func (s *NativePoseidon2State) matMulExternal() {
+	var sum fr.Element
+	sum.Add(&s.s[0], &s.s[1]).Add(&sum, &s.s[2])
+	for i := range s.s {
+		s.s[i].Add(&s.s[i], &sum)
+	}
+}
+
+func (s *NativePoseidon2State) matMulInternal() {
+	var sum fr.Element
+	sum.Add(&s.s[0], &s.s[1]).Add(&sum, &s.s[2])
+	s.s[0].Add(&s.s[0], &sum)
+	s.s[1].Add(&s.s[1], &sum)
+	s.s[2].Double(&s.s[2]).Add(&s.s[2], &sum)
+}
+
+func (s *NativePoseidon2State) Permute() {
+	s.matMulExternal()
+	for round := range poseidon2Constants {
+		if isPoseidon2FullRound(round) {
+			for i := range s.s {
+				s.s[i].Add(&s.s[i], &poseidon2Constants[round][i])
+				s.sBox(i)
+			}
+			s.matMulExternal()
+		} else {
+			s.s[0].Add(&s.s[0], &poseidon2Constants[round][0])
+			s.sBox(0)
+			s.matMulInternal()
+		}
+	}
+}
+
+func (s *NativePoseidon2State) State() []fr.Element {
+	return s.s[:]
+}
+
+func (s *NativePoseidon2State) Zeroize(index int) {
+	s.s[index].SetZero()
+}
+
+func (s *NativePoseidon2State) PrintState(api frontend.API) {
+	vars := make([]frontend.Variable, len(s.s))
+	for i := range s.s {
+		vars[i] = s.s[i].String()
+	}
+	api.Println(vars...)
+}
+
+type NativePoseidon2 DuplexHash[fr.Element]
+
+func NewNativePoseidon2() NativePoseidon2 {
+	return &DuplexSponge[fr.Element, *NativePoseidon2State]{
+		sponge: &NativePoseidon2State{},
+	}
+}
@@ -0,0 +1,63 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// poseidon2Vector is the image of (0, 1, 2) under the width-3 BN254
+// permutation, from the test of poseidon2_instance_bn256 in the HorizenLabs
+// reference implementation.
+var poseidon2Vector = [Poseidon2Width]string{
+	"0x0bb61d24daca55eebcb1929a82650f328134334da98ea4f847f760054f4a3033",
+	"0x303b6f7c86d043bfcbcc80214f26a30277a15d3f74ca654992defe7ff8d03570",
+	"0x1ed25194542b12eef8617361c3ba7c52e660b145994427cc86296242cf766ec8",
+}
+
+type poseidon2Circuit struct {
+	In, Out [Poseidon2Width]frontend.Variable
+}
+
+func (c *poseidon2Circuit) Define(api frontend.API) error {
+	sponge, err := NewPoseidon2(api)
+	if err != nil {
+		return err
+	}
+	state := sponge.(*DuplexSponge[frontend.Variable, *Poseidon2State]).sponge
+	copy(state.s[:], c.In[:])
+	state.Permute()
+	for i := range c.Out {
+		api.AssertIsEqual(state.s[i], c.Out[i])
+	}
+	return nil
+}
+
+func TestPoseidon2Permutation(t *testing.T) {
+	assignment := poseidon2Circuit{In: [Poseidon2Width]frontend.Variable{0, 1, 2}}
+	for i, v := range poseidon2Vector {
+		assignment.Out[i] = v
+	}
+	assert.Nil(t, test.IsSolved(&poseidon2Circuit{}, &assignment, ecc.BN254.ScalarField()))
+
+	sponge := NewNativePoseidon2().(*DuplexSponge[fr.Element, *NativePoseidon2State]).sponge
+	sponge.s[1].SetUint64(1)
+	sponge.s[2].SetUint64(2)
+	sponge.Permute()
+	for i, v := range poseidon2Vector {
+		var expected fr.Element
+		_, err := expected.SetString(v)
+		assert.Nil(t, err)
+		assert.True(t, expected.Equal(&sponge.s[i]), i)
+	}
+}
+
+func TestPoseidon2RejectsOtherFields(t *testing.T) {
+	_, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &poseidon2Circuit{})
+	assert.ErrorContains(t, err, "only defined over BN254")
+}
@@ -0,0 +1,128 @@
+package hash
+
+import (
+	"math/big"
+	"math/bits"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+var (
+	nativeSkyscraperSigma fr.Element
+	nativeSkyscraperRc    [18]fr.Element
+)
+
+func init() {
+	nativeSkyscraperSigma.SetString("9915499612839321149637521777990102151350674507940716049588462388200839649614")
+	rc := [18]string{
+		"0",
+		"17829420340877239108687448009732280677191990375576158938221412342251481978692",
+		"5852100059362614845584985098022261541909346143980691326489891671321030921585",
+		"17048088173265532689680903955395019356591870902241717143279822196003888806966",
+		"71577923540621522166602308362662170286605786204339342029375621502658138039",
+		"1630526119629192105940988602003704216811347521589219909349181656165466494167",
+		"7807402158218786806372091124904574238561123446618083586948014838053032654983",
+		"13329560971460034925899588938593812685746818331549554971040309989641523590611",
+		"16971509144034029782226530622087626979814683266929655790026304723118124142299",
+		"8608910393531852188108777530736778805001620473682472554749734455948859886057",
+		"10789906636021659141392066577070901692352605261812599600575143961478236801530",
+		"18708129585851494907644197977764586873688181219062643217509404046560774277231",
+		"8383317008589863184762767400375936634388677459538766150640361406080412989586",
+		"10555553646766747611187318546907885054893417621612381305146047194084618122734",
+		"18278062107303135832359716534360847832111250949377506216079581779892498540823",
+		"9307964587880364850754205696017897664821998926660334400055925260019288889718",
+		"13066217995902074168664295654459329310074418852039335279433003242098078040116",
+		"0",
+	}
+	for i, c := range rc {
+		nativeSkyscraperRc[i].SetString(c)
+	}
+}
+
+func nativeSkyscraperSbox(b byte) byte {
+	x := bits.RotateLeft8(^b, 1)
+	y := bits.RotateLeft8(b, 2)
+	z := bits.RotateLeft8(b, 3)
+	return bits.RotateLeft8(b^(x&y&z), 1)
+}
+
+func nativeSkyscraperSquare(v *fr.Element) fr.Element {
+	var r fr.Element
+	r.Square(v).Mul(&r, &nativeSkyscraperSigma)
+	return r
+}
+
+func nativeSkyscraperBar(v *fr.Element) fr.Element {
+	b := v.Bytes()
+	var swapped [32]byte
+	copy(swapped[:16], b[16:])
+	copy(swapped[16:], b[:16])
+	for i := range swapped {
+		swapped[i] = nativeSkyscraperSbox(swapped[i])
+	}
+	var r fr.Element
+	r.SetBigInt(new(big.Int).SetBytes(swapped[:]))
+	return r
+}
+
+// NativeSkyscraperPermute is the out-of-circuit version of
+// skyscraper.Skyscraper.PermuteV2.
+func NativeSkyscraperPermute(state *[2]fr.Element) {
+	l, r := state[0], state[1]
+	for i := range nativeSkyscraperRc {
+		var t fr.Element
+		if i == 6 || i == 7 || i == 10 || i == 11 {
+			t = nativeSkyscraperBar(&l)
+		} else {
+			t = nativeSkyscraperSquare(&l)
+		}
+		t.Add(&t, &r).Add(&t, &nativeSkyscraperRc[i])
+		l, r = t, l
+	}
+	state[0], state[1] = l, r
+}
+
+// NativeSkyscraperState is the out-of-circuit counterpart of SkyscraperState.
+type NativeSkyscraperState struct {
+	s [2]fr.Element
+}
+
+func (s *NativeSkyscraperState) N() int {
+	return 2
+}
+
+func (s *NativeSkyscraperState) R() int {
+	return 1
+}
+
+func (s *NativeSkyscraperState) Initialize(iv [32]byte) {
+	slices.Reverse(iv[:])
+	s.s[0].SetZero()
+	s.s[1].SetBigInt(new(big.Int).SetBytes(iv[:]))
+}
+
+func (s *NativeSkyscraperState) Permute() {
+	NativeSkyscraperPermute(&s.s)
+}
+
+func (s *NativeSkyscraperState) State() []fr.Element {
+	return s.s[:]
+}
+
+func (s *NativeSkyscraperState) Zeroize(index int) {
+	s.s[index].SetZero()
+}
+
+func (s *NativeSkyscraperState) PrintState(api frontend.API) {
+	api.Println(s.s[0].String(), s.s[1].String())
+}
+
+type NativeSkyscraper DuplexHash[fr.Element]
+
+func NewNativeSkyscraper() NativeSkyscraper {
+	return &DuplexSponge[fr.Element, *NativeSkyscraperState]{
+		sponge: &NativeSkyscraperState{},
+	}
+}
@@ -64,7 +64,7 @@ func (s *DuplexSponge[U, S]) Squeeze(output []U) {
 
 	chunkLen := min(len(output), s.sponge.R()-s.squeezePos)
 	output, rest := output[:chunkLen], output[chunkLen:]
-	copy(output, s.sponge.State())
+	copy(output, s.sponge.State()[s.squeezePos:])
 	s.squeezePos += chunkLen
 	s.Squeeze(rest)
 }
@@ -0,0 +1,159 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// indexBytes is the number of challenge bytes WHIR squeezes per index into a
+// domain of size 2^domainBits: ((2*size-1).ilog2()+7)/8.
+func indexBytes(domainBits int) int {
+	return (domainBits + 7) / 8
+}
+
+func checkIndicesArgs(count, domainBits int) error {
+	if count < 0 || domainBits < 0 || domainBits > 63 {
+		return fmt.Errorf("invalid index challenge: %d indices of %d bits", count, domainBits)
+	}
+	return nil
+}
+
+func init() {
+	solver.RegisterHint(sortIndicesHint)
+}
+
+// sortIndicesHint sorts and deduplicates its inputs into the first outputs,
+// followed by the position of every input among them and the position among
+// the inputs of every distinct index.
+func sortIndicesHint(_ *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+	unique := (len(outputs) - len(inputs)) / 2
+	if len(inputs)+2*unique != len(outputs) {
+		return fmt.Errorf("sortIndicesHint: %d outputs for %d inputs", len(outputs), len(inputs))
+	}
+	sorted := make([]uint64, len(inputs))
+	for i, input := range inputs {
+		sorted[i] = input.Uint64()
+	}
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	// another number of distinct indices fails the constraints, the outputs
+	// only have to be well defined
+	sorted = append(sorted, make([]uint64, max(unique-len(sorted), 0))...)[:unique]
+	for i, index := range sorted {
+		outputs[i].SetUint64(index)
+		source := slices.IndexFunc(inputs, func(input *big.Int) bool { return input.Uint64() == index })
+		outputs[unique+len(inputs)+i].SetUint64(uint64(max(source, 0)))
+	}
+	for i, input := range inputs {
+		position, _ := slices.BinarySearch(sorted, input.Uint64())
+		outputs[unique+i].SetUint64(uint64(min(position, unique-1)))
+	}
+	return nil
+}
+
+// fillChallengeIndices derives count indices in [0, 2^domainBits) like WHIR:
+// all bytes are squeezed in one call, each index is read big-endian from its
+// chunk and reduced modulo the domain size. Like ChallengeIndices, the
+// indices are returned sorted and deduplicated together with their
+// little-endian bits. As the circuit shape must not depend on the challenge,
+// the number of distinct indices is given by unique, and a challenge with
+// another number of distinct indices fails the constraints.
+func fillChallengeIndices(api frontend.API, arthur Arthur, count, unique, domainBits int) ([]frontend.Variable, [][]frontend.Variable, error) {
+	err := checkIndicesArgs(count, domainBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	if unique < min(count, 1) || unique > min(count, 1<<domainBits) {
+		return nil, nil, fmt.Errorf("%d indices of %d bits cannot have %d distinct values", count, domainBits, unique)
+	}
+	size := indexBytes(domainBits)
+	bytes := make([]uints.U8, count*size)
+	err = arthur.FillChallengeBytes(bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	indices := make([]frontend.Variable, count)
+	for i := range count {
+		chunk := bytes[i*size : (i+1)*size]
+		leBits := make([]frontend.Variable, 0, 8*size)
+		for j := size - 1; j >= 0; j-- {
+			leBits = append(leBits, bits.ToBinary(api, chunk[j].Val, bits.WithNbDigits(8))...)
+		}
+		indices[i] = frontend.Variable(0)
+		if domainBits > 0 {
+			indices[i] = bits.FromBinary(api, leBits[:domainBits])
+		}
+	}
+	if unique == 0 {
+		return nil, nil, nil
+	}
+	if domainBits == 0 {
+		// every index is 0
+		return []frontend.Variable{0}, [][]frontend.Variable{{}}, nil
+	}
+
+	hinted, err := api.Compiler().NewHint(sortIndicesHint, 2*unique+count, indices...)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted := hinted[:unique]
+	sortedBits := make([][]frontend.Variable, unique)
+	for i := range sorted {
+		sortedBits[i] = bits.ToBinary(api, sorted[i], bits.WithNbDigits(domainBits))
+		if i > 0 {
+			// the difference minus one fits the domain only if the indices
+			// strictly increase
+			bits.ToBinary(api, api.Sub(sorted[i], sorted[i-1], 1), bits.WithNbDigits(domainBits))
+		}
+	}
+	// every index is one of the sorted ones and every sorted one is an index,
+	// so with strictly increasing values they are exactly the distinct indices
+	sortedTable := logderivlookup.New(api)
+	for _, index := range sorted {
+		sortedTable.Insert(index)
+	}
+	for i, index := range sortedTable.Lookup(hinted[unique : unique+count]...) {
+		api.AssertIsEqual(index, indices[i])
+	}
+	indexTable := logderivlookup.New(api)
+	for _, index := range indices {
+		indexTable.Insert(index)
+	}
+	for i, index := range indexTable.Lookup(hinted[unique+count:]...) {
+		api.AssertIsEqual(index, sorted[i])
+	}
+	return sorted, sortedBits, nil
+}
+
+// ChallengeIndices derives count indices in [0, 2^domainBits) and returns
+// them sorted and deduplicated, exactly like WHIR's get_challenge_stir_queries.
+// Use it to find the Merkle openings a WHIR prover sends, and their number to
+// size Arthur.FillChallengeIndices.
+func ChallengeIndices(arthur NativeArthur, count, domainBits int) ([]uint64, error) {
+	err := checkIndicesArgs(count, domainBits)
+	if err != nil {
+		return nil, err
+	}
+	size := indexBytes(domainBits)
+	bytes := make([]byte, count*size)
+	err = arthur.FillChallengeBytes(bytes)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint64, count)
+	for i := range count {
+		for _, b := range bytes[i*size : (i+1)*size] {
+			indices[i] = indices[i]<<8 | uint64(b)
+		}
+		indices[i] %= 1 << domainBits
+	}
+	slices.Sort(indices)
+	return slices.Compact(indices), nil
+}
@@ -0,0 +1,95 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type indicesCircuit struct {
+	IO         []byte
+	Hash       string
+	Count      int
+	DomainBits int
+	Transcript []uints.U8
+	Indices    []frontend.Variable
+}
+
+func (circuit *indicesCircuit) Define(api frontend.API) error {
+	arthur, err := newTestArthur(api, circuit.Hash, circuit.IO, circuit.Transcript)
+	if err != nil {
+		return err
+	}
+	indices, indexBits, err := arthur.FillChallengeIndices(circuit.Count, len(circuit.Indices), circuit.DomainBits)
+	if err != nil {
+		return err
+	}
+	for i := range indices {
+		api.AssertIsEqual(indices[i], circuit.Indices[i])
+		if len(indexBits[i]) != circuit.DomainBits {
+			return fmt.Errorf("index %d has %d bits", i, len(indexBits[i]))
+		}
+		recomposed := frontend.Variable(0)
+		for j := len(indexBits[i]) - 1; j >= 0; j-- {
+			recomposed = api.Add(api.Mul(recomposed, 2), indexBits[i][j])
+		}
+		api.AssertIsEqual(recomposed, indices[i])
+	}
+	return arthur.Finish()
+}
+
+func checkChallengeIndices(t *testing.T, hashName string, count, domainBits int) {
+	size := (domainBits + 7) / 8
+	io := buildIO(t, NewIOPattern("indices").WithCodec(testCodec(hashName)).SqueezeBytes(count*size, "stir_queries"))
+
+	merlin, err := newTestMerlin(hashName, io)
+	assert.Nil(t, err)
+	bytes := make([]byte, count*size)
+	assert.Nil(t, merlin.ChallengeBytes(bytes))
+	expected := make([]uint64, count)
+	for i := range count {
+		for _, b := range bytes[i*size : (i+1)*size] {
+			expected[i] = expected[i]<<8 | uint64(b)
+		}
+		expected[i] &= 1<<domainBits - 1
+	}
+
+	arthur, err := newTestNativeArthur(hashName, io, merlin.Transcript())
+	assert.Nil(t, err)
+	unique, err := ChallengeIndices(arthur, count, domainBits)
+	assert.Nil(t, err)
+	slices.Sort(expected)
+	assert.Equal(t, slices.Compact(expected), unique)
+
+	check := func(indices []uint64) error {
+		circuit := indicesCircuit{IO: io, Hash: hashName, Count: count, DomainBits: domainBits, Indices: make([]frontend.Variable, len(indices))}
+		assignment := indicesCircuit{IO: io, Hash: hashName, Count: count, DomainBits: domainBits, Transcript: []uints.U8{}, Indices: make([]frontend.Variable, len(indices))}
+		for i := range indices {
+			assignment.Indices[i] = indices[i]
+		}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	assert.Nil(t, check(unique))
+	// the circuit is sized by the number of distinct indices, which it checks
+	assert.NotNil(t, check(unique[1:]))
+	if len(unique) < count {
+		assert.NotNil(t, check(append(slices.Clone(unique), unique[len(unique)-1]+1)))
+	}
+}
+
+func TestKeccakChallengeIndices(t *testing.T) {
+	checkChallengeIndices(t, "keccak", 20, 10)
+	// 40 indices in a domain of 32 elements must repeat
+	checkChallengeIndices(t, "keccak", 40, 5)
+}
+
+func TestSkyscraperChallengeIndices(t *testing.T) {
+	checkChallengeIndices(t, "skyscraper", 20, 10)
+	checkChallengeIndices(t, "skyscraper", 40, 5)
+}
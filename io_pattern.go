@@ -1,6 +1,13 @@
 package gnark_nimue
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"unicode/utf8"
+)
 
 type OpKind uint8
 
@@ -25,6 +32,23 @@ func (kind OpKind) String() string {
 	return "Unknown"
 }
 
+func (kind OpKind) MarshalText() ([]byte, error) {
+	if kind > Hint {
+		return nil, fmt.Errorf("OpKind.MarshalText: unknown op kind %d", kind)
+	}
+	return []byte(kind.String()), nil
+}
+
+func (kind *OpKind) UnmarshalText(text []byte) error {
+	for k := Absorb; k <= Hint; k++ {
+		if k.String() == string(text) {
+			*kind = k
+			return nil
+		}
+	}
+	return fmt.Errorf("OpKind.UnmarshalText: unknown op kind %q", text)
+}
+
 type Op struct {
 	Kind  OpKind
 	Label []byte
@@ -61,18 +85,45 @@ func (io *IOPattern) PPrint() string {
 
 const SepByte byte = 0
 
-func parseUntilSep(buf []byte, sep byte) (result []byte, rest []byte) {
+var (
+	ErrEmptyDomainSeparator = errors.New("empty domain separator")
+	ErrEmptyOp              = errors.New("empty op")
+	ErrUnknownOpKind        = errors.New("unknown op kind")
+	ErrZeroSize             = errors.New("zero-size op")
+	ErrSizeOverflow         = errors.New("size overflows uint64")
+	ErrUnexpectedLabel      = errors.New("op does not take a label")
+	ErrUnexpectedSize       = errors.New("op does not take a size")
+	ErrLabelStartsWithDigit = errors.New("label starts with a digit")
+	ErrInvalidLabel         = errors.New("label is not valid UTF-8 or contains a separator")
+)
+
+// ParseError reports why an IO pattern was rejected and the byte offset in
+// the pattern where the problem starts.
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("IOPattern.Parse: %v at offset %d", e.Err, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func parseUntilSep(buf []byte, sep byte) (result []byte, rest []byte, found bool) {
 	for i, b := range buf {
 		if b == sep {
-			return buf[:i], buf[i+1:]
+			return buf[:i], buf[i+1:], true
 		}
 	}
-	return buf, nil
+	return buf, nil, false
 }
 
-func parseOpKind(patStr []byte) (OpKind, []byte, error) {
+func parseOpKind(patStr []byte, offset int) (OpKind, []byte, error) {
 	if len(patStr) == 0 {
-		return 0, nil, fmt.Errorf("parseOpKind: empty input")
+		return 0, nil, &ParseError{offset, ErrEmptyOp}
 	}
 	switch patStr[0] {
 	case 'A':
@@ -84,43 +135,199 @@ func parseOpKind(patStr []byte) (OpKind, []byte, error) {
 	case 'H':
 		return Hint, patStr[1:], nil
 	}
-	return 0, nil, fmt.Errorf("parseOpKind: unknown op kind: %s", string(patStr[:1]))
+	return 0, nil, &ParseError{offset, fmt.Errorf("%w %q", ErrUnknownOpKind, patStr[:1])}
 }
 
-func parseSize(patStr []byte) (uint64, []byte) {
+func parseSize(patStr []byte, offset int) (uint64, []byte, error) {
 	var result uint64 = 0
 	for i, b := range patStr {
 		if b < '0' || b > '9' {
-			return result, patStr[i:]
+			return result, patStr[i:], nil
 		}
-		result = result*10 + uint64(b-'0')
+		digit := uint64(b - '0')
+		if result > (math.MaxUint64-digit)/10 {
+			return 0, nil, &ParseError{offset, ErrSizeOverflow}
+		}
+		result = result*10 + digit
 	}
-	return result, nil
+	return result, patStr[len(patStr):], nil
 }
 
-func parseOp(patStr []byte) (Op, []byte, error) {
-	kind, patStr, err := parseOpKind(patStr)
+// parseOp parses a single op that starts at the given offset of the pattern.
+func parseOp(opStr []byte, offset int) (Op, error) {
+	kind, rest, err := parseOpKind(opStr, offset)
+	if err != nil {
+		return Op{}, err
+	}
+	size, label, err := parseSize(rest, offset+1)
 	if err != nil {
-		return Op{}, patStr, err
+		return Op{}, err
+	}
+	labelOffset := offset + len(opStr) - len(label)
+	switch kind {
+	case Absorb, Squeeze:
+		if size == 0 {
+			return Op{}, &ParseError{offset + 1, ErrZeroSize}
+		}
+	case Ratchet:
+		if len(rest) > 0 {
+			return Op{}, &ParseError{offset + 1, ErrUnexpectedLabel}
+		}
+	case Hint:
+		// hints carry no size, so leading digits belong to the label
+		if len(rest) != len(label) {
+			return Op{}, &ParseError{offset + 1, ErrLabelStartsWithDigit}
+		}
+	}
+	if !utf8.Valid(label) {
+		return Op{}, &ParseError{labelOffset, ErrInvalidLabel}
 	}
-	size, patStr := parseSize(patStr)
-	label, patStr := parseUntilSep(patStr, SepByte)
-	return Op{Kind: kind, Label: label, Size: size}, patStr, nil
+	return Op{Kind: kind, Label: label, Size: size}, nil
 }
 
+// Parse reads an IO pattern in the format produced by nimue. Patterns nimue
+// would not produce, such as zero-size ops or labels starting with a digit,
+// are rejected with a *ParseError.
 func (io *IOPattern) Parse(patStr []byte) error {
-	io.DomainSeparator, patStr = parseUntilSep(patStr, SepByte)
-	for len(patStr) > 0 {
-		nextOp, nextPatStr, err := parseOp(patStr)
+	domain, rest, found := parseUntilSep(patStr, SepByte)
+	if len(domain) == 0 {
+		return &ParseError{0, ErrEmptyDomainSeparator}
+	}
+	if !utf8.Valid(domain) {
+		return &ParseError{0, ErrInvalidLabel}
+	}
+	io.DomainSeparator = domain
+	offset := len(domain) + 1
+	for found {
+		var opStr []byte
+		opStr, rest, found = parseUntilSep(rest, SepByte)
+		nextOp, err := parseOp(opStr, offset)
 		if err != nil {
 			return err
 		}
 		io.Ops = append(io.Ops, nextOp)
-		patStr = nextPatStr
+		offset += len(opStr) + 1
 	}
 	return nil
 }
 
+// validate checks that Parse reads back the ops of the pattern as they are,
+// and returns a *ParseError at the offset of the first op that it would reject
+// or read differently.
+func (io *IOPattern) validate() error {
+	if len(io.DomainSeparator) == 0 {
+		return &ParseError{0, ErrEmptyDomainSeparator}
+	}
+	if !utf8.Valid(io.DomainSeparator) || slices.Contains(io.DomainSeparator, SepByte) {
+		return &ParseError{0, ErrInvalidLabel}
+	}
+	offset := len(io.DomainSeparator) + 1
+	for _, op := range io.Ops {
+		labelOffset := offset + 1
+		switch op.Kind {
+		case Absorb, Squeeze:
+			if op.Size == 0 {
+				return &ParseError{offset + 1, ErrZeroSize}
+			}
+			labelOffset += len(fmt.Sprint(op.Size))
+		case Ratchet, Hint:
+			if op.Size != 0 {
+				return &ParseError{offset + 1, ErrUnexpectedSize}
+			}
+			if op.Kind == Ratchet && len(op.Label) > 0 {
+				return &ParseError{offset + 1, ErrUnexpectedLabel}
+			}
+		default:
+			return &ParseError{offset, fmt.Errorf("%w %d", ErrUnknownOpKind, op.Kind)}
+		}
+		if len(op.Label) > 0 && op.Label[0] >= '0' && op.Label[0] <= '9' {
+			return &ParseError{labelOffset, ErrLabelStartsWithDigit}
+		}
+		if !utf8.Valid(op.Label) || slices.Contains(op.Label, SepByte) {
+			return &ParseError{labelOffset, ErrInvalidLabel}
+		}
+		offset = labelOffset + len(op.Label) + 1
+	}
+	return nil
+}
+
+// Bytes returns the pattern string expected by Parse and NewSafe.
+func (io *IOPattern) Bytes() []byte {
+	result := append([]byte{}, io.DomainSeparator...)
+	for _, op := range io.Ops {
+		result = append(result, SepByte)
+		switch op.Kind {
+		case Absorb:
+			result = fmt.Appendf(result, "A%d", op.Size)
+		case Squeeze:
+			result = fmt.Appendf(result, "S%d", op.Size)
+		case Ratchet:
+			result = append(result, 'R')
+		case Hint:
+			result = append(result, 'H')
+		}
+		result = append(result, op.Label...)
+	}
+	return result
+}
+
+func (io *IOPattern) MarshalBinary() ([]byte, error) {
+	return io.Bytes(), nil
+}
+
+func (io *IOPattern) UnmarshalBinary(data []byte) error {
+	*io = IOPattern{}
+	return io.Parse(data)
+}
+
+type jsonOp struct {
+	Kind  OpKind `json:"kind"`
+	Size  uint64 `json:"size,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+type jsonIOPattern struct {
+	DomainSeparator string   `json:"domainSeparator"`
+	Ops             []jsonOp `json:"ops"`
+}
+
+// MarshalJSON encodes the pattern with readable labels, which therefore have
+// to be valid UTF-8.
+func (io *IOPattern) MarshalJSON() ([]byte, error) {
+	if !utf8.Valid(io.DomainSeparator) {
+		return nil, fmt.Errorf("IOPattern.MarshalJSON: domain separator is not valid UTF-8")
+	}
+	result := jsonIOPattern{DomainSeparator: string(io.DomainSeparator), Ops: make([]jsonOp, len(io.Ops))}
+	for i, op := range io.Ops {
+		if !utf8.Valid(op.Label) {
+			return nil, fmt.Errorf("IOPattern.MarshalJSON: label of op %d is not valid UTF-8", i)
+		}
+		result.Ops[i] = jsonOp{Kind: op.Kind, Size: op.Size, Label: string(op.Label)}
+	}
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON decodes a pattern written by MarshalJSON. Patterns that Parse
+// would reject are rejected with the same *ParseError.
+func (io *IOPattern) UnmarshalJSON(data []byte) error {
+	var pattern jsonIOPattern
+	err := json.Unmarshal(data, &pattern)
+	if err != nil {
+		return err
+	}
+	decoded := IOPattern{DomainSeparator: []byte(pattern.DomainSeparator), Ops: make([]Op, len(pattern.Ops))}
+	for i, op := range pattern.Ops {
+		decoded.Ops[i] = Op{Kind: op.Kind, Label: []byte(op.Label), Size: op.Size}
+	}
+	// the same checks as Parse, with offsets into decoded.Bytes()
+	err = decoded.validate()
+	if err != nil {
+		return err
+	}
+	*io = decoded
+	return nil
+}
+
 type OpQueue struct {
 	ops []Op
 }
@@ -143,6 +350,14 @@ func (stack *OpQueue) doOp(kind OpKind, size uint64) error {
 	return nil
 }
 
+// next returns the op to perform next, or the zero Op if none is left.
+func (stack *OpQueue) next() Op {
+	if len(stack.ops) == 0 {
+		return Op{}
+	}
+	return stack.ops[0]
+}
+
 func (stack *OpQueue) Squeeze(size uint64) error {
 	return stack.doOp(Squeeze, size)
 }
@@ -151,18 +366,51 @@ func (stack *OpQueue) Absorb(size uint64) error {
 	return stack.doOp(Absorb, size)
 }
 
+// popOp consumes a whole op that carries no size, such as Ratchet or Hint.
+func (stack *OpQueue) popOp(kind OpKind) error {
+	if len(stack.ops) == 0 {
+		return fmt.Errorf("OpStack.popOp: empty stack")
+	}
+	if stack.ops[0].Kind != kind {
+		return fmt.Errorf("OpStack.popOp: expected %v, got %s %s", kind, stack.ops[0].Kind, stack.ops[0].Label)
+	}
+	stack.ops = stack.ops[1:]
+	return nil
+}
+
+func (stack *OpQueue) Ratchet() error {
+	return stack.popOp(Ratchet)
+}
+
+func (stack *OpQueue) Hint() error {
+	return stack.popOp(Hint)
+}
+
+func (stack *OpQueue) Finish() error {
+	for _, op := range stack.ops {
+		if op.Kind != Hint {
+			return fmt.Errorf("OpStack.Finish: unconsumed %v %d %s", op.Kind, op.Size, op.Label)
+		}
+	}
+	return nil
+}
+
+// GetOpQueue returns the ops left to perform. Like nimue, consecutive Absorb
+// or Squeeze ops are merged, so a single call may span several ops of the
+// pattern. Labels of merged ops are joined with ", " for error messages.
 func (io *IOPattern) GetOpQueue(ignoreHints bool) OpQueue {
-	if ignoreHints {
-		newOps := []Op{}
-		for _, op := range io.Ops {
-			if op.Kind != Hint {
-				newOps = append(newOps, op)
-			}
+	newOps := []Op{}
+	for _, op := range io.Ops {
+		if ignoreHints && op.Kind == Hint {
+			continue
+		}
+		last := len(newOps) - 1
+		if last >= 0 && newOps[last].Kind == op.Kind && (op.Kind == Absorb || op.Kind == Squeeze) {
+			newOps[last].Size += op.Size
+			newOps[last].Label = slices.Concat(newOps[last].Label, []byte(", "), op.Label)
+			continue
 		}
-		return OpQueue{ops: newOps}
-	} else {
-		newOps := make([]Op, len(io.Ops))
-		copy(newOps, io.Ops)
-		return OpQueue{ops: newOps}
+		newOps = append(newOps, op)
 	}
+	return OpQueue{ops: newOps}
 }
@@ -0,0 +1,200 @@
+package gnark_nimue
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Codec describes how bytes and scalars map to the units counted by an IO
+// pattern. Byte sponges such as Keccak count bytes, while field sponges such
+// as Skyscraper and Poseidon2 count elements of the native field.
+type Codec struct {
+	Field       *big.Int
+	FieldSponge bool
+}
+
+// ByteCodec is the codec of byte sponges over the given native field.
+func ByteCodec(field *big.Int) Codec {
+	return Codec{Field: field}
+}
+
+// FieldCodec is the codec of sponges over the given native field.
+func FieldCodec(field *big.Int) Codec {
+	return Codec{Field: field, FieldSponge: true}
+}
+
+// absorbBytesSize is the number of units taken by absorbing n bytes.
+func (codec Codec) absorbBytesSize(n int) (uint64, error) {
+	return uint64(n), nil
+}
+
+// squeezeBytesSize is the number of units taken by squeezing n bytes in a
+// single call. Field sponges squeeze one element per randomBytesInField
+// bytes.
+func (codec Codec) squeezeBytesSize(n int) (uint64, error) {
+	if !codec.FieldSponge {
+		return uint64(n), nil
+	}
+	numBytes, err := randomBytesInField(codec.Field)
+	if err != nil {
+		return 0, err
+	}
+	return uint64((n + numBytes - 1) / numBytes), nil
+}
+
+func (codec Codec) absorbScalarsSize(n int) (uint64, error) {
+	if codec.FieldSponge {
+		return uint64(n), nil
+	}
+	return uint64(n * ((codec.Field.BitLen() + 7) / 8)), nil
+}
+
+func (codec Codec) squeezeScalarsSize(n int) (uint64, error) {
+	if codec.FieldSponge {
+		return uint64(n), nil
+	}
+	return uint64(n * ((codec.Field.BitLen() + 128) / 8)), nil
+}
+
+// ErrNoCodec is returned when a scalar op is added to a builder without a
+// codec.
+var ErrNoCodec = errors.New("scalar op needs a codec")
+
+// IOPatternBuilder builds an IO pattern op by op. The first invalid op is
+// recorded, later ops are ignored, and the error is returned by Err and
+// Build.
+type IOPatternBuilder struct {
+	io    IOPattern
+	codec *Codec
+	err   error
+}
+
+// NewIOPattern starts building an IO pattern for the given domain separator.
+// Bytes are counted as by a byte sponge until WithCodec sets another codec.
+func NewIOPattern(domain string) *IOPatternBuilder {
+	builder := &IOPatternBuilder{io: IOPattern{DomainSeparator: []byte(domain)}}
+	builder.err = builder.io.validate()
+	return builder
+}
+
+// WithCodec sets the codec deriving the sizes of the next ops, so the same
+// protocol description yields e.g. "S47" for Keccak and "S1" for Skyscraper
+// over BN254. Scalar ops need a codec.
+func (builder *IOPatternBuilder) WithCodec(codec Codec) *IOPatternBuilder {
+	builder.codec = &codec
+	return builder
+}
+
+// Err returns the first error met while building.
+func (builder *IOPatternBuilder) Err() error {
+	return builder.err
+}
+
+// Build returns the pattern, which Parse reads back identically, or the first
+// error met while building.
+func (builder *IOPatternBuilder) Build() (*IOPattern, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+	io := IOPattern{DomainSeparator: builder.io.DomainSeparator, Ops: append([]Op(nil), builder.io.Ops...)}
+	return &io, nil
+}
+
+// addOp appends an op of the size returned by size, checking it like Parse.
+func (builder *IOPatternBuilder) addOp(kind OpKind, size func() (uint64, error), label string) *IOPatternBuilder {
+	if builder.err != nil {
+		return builder
+	}
+	n, err := size()
+	if err != nil {
+		builder.err = fmt.Errorf("IOPattern: %s %q: %w", kind, label, err)
+		return builder
+	}
+	builder.io.Ops = append(builder.io.Ops, Op{Kind: kind, Label: []byte(label), Size: n})
+	builder.err = builder.io.validate()
+	return builder
+}
+
+// bytesSize returns the size of n bytes under the codec, or of a byte sponge
+// without codec.
+func (builder *IOPatternBuilder) bytesSize(n int, size func(Codec, int) (uint64, error)) func() (uint64, error) {
+	return func() (uint64, error) {
+		if n < 0 {
+			return 0, ErrZeroSize
+		}
+		if builder.codec == nil {
+			return uint64(n), nil
+		}
+		return size(*builder.codec, n)
+	}
+}
+
+// scalarsSize returns the size of n scalars under the codec.
+func (builder *IOPatternBuilder) scalarsSize(n int, size func(Codec, int) (uint64, error)) func() (uint64, error) {
+	return func() (uint64, error) {
+		if n < 0 {
+			return 0, ErrZeroSize
+		}
+		if builder.codec == nil {
+			return 0, ErrNoCodec
+		}
+		return size(*builder.codec, n)
+	}
+}
+
+// AbsorbBytes appends an op for n bytes read with FillNextBytes.
+func (builder *IOPatternBuilder) AbsorbBytes(n int, label string) *IOPatternBuilder {
+	return builder.addOp(Absorb, builder.bytesSize(n, Codec.absorbBytesSize), label)
+}
+
+// SqueezeBytes appends an op for n bytes squeezed by one FillChallengeBytes
+// call.
+func (builder *IOPatternBuilder) SqueezeBytes(n int, label string) *IOPatternBuilder {
+	return builder.addOp(Squeeze, builder.bytesSize(n, Codec.squeezeBytesSize), label)
+}
+
+// AbsorbScalars appends an op for n native scalars read with FillNextScalars.
+func (builder *IOPatternBuilder) AbsorbScalars(n int, label string) *IOPatternBuilder {
+	return builder.addOp(Absorb, builder.scalarsSize(n, Codec.absorbScalarsSize), label)
+}
+
+// SqueezeScalars appends an op for n native scalars squeezed with
+// FillChallengeScalars.
+func (builder *IOPatternBuilder) SqueezeScalars(n int, label string) *IOPatternBuilder {
+	return builder.addOp(Squeeze, builder.scalarsSize(n, Codec.squeezeScalarsSize), label)
+}
+
+// AbsorbEmulatedScalars appends an op for n scalars of the given modulus read
+// with FillNextEmulatedScalars.
+func (builder *IOPatternBuilder) AbsorbEmulatedScalars(n int, modulus *big.Int, label string) *IOPatternBuilder {
+	size := builder.bytesSize((modulus.BitLen()+7)/8, Codec.absorbBytesSize)
+	return builder.addOp(Absorb, func() (uint64, error) { return multiply(n, size) }, label)
+}
+
+// SqueezeEmulatedScalars appends an op for n scalars of the given modulus
+// squeezed with FillChallengeEmulatedScalars.
+func (builder *IOPatternBuilder) SqueezeEmulatedScalars(n int, modulus *big.Int, label string) *IOPatternBuilder {
+	size := builder.bytesSize((modulus.BitLen()+128)/8, Codec.squeezeBytesSize)
+	return builder.addOp(Squeeze, func() (uint64, error) { return multiply(n, size) }, label)
+}
+
+// multiply returns n times the size of one scalar.
+func multiply(n int, size func() (uint64, error)) (uint64, error) {
+	if n < 0 {
+		return 0, ErrZeroSize
+	}
+	one, err := size()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n) * one, nil
+}
+
+func (builder *IOPatternBuilder) Ratchet() *IOPatternBuilder {
+	return builder.addOp(Ratchet, func() (uint64, error) { return 0, nil }, "")
+}
+
+func (builder *IOPatternBuilder) Hint(label string) *IOPatternBuilder {
+	return builder.addOp(Hint, func() (uint64, error) { return 0, nil }, label)
+}
@@ -0,0 +1,256 @@
+package gnark_nimue
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildIO returns the bytes of the pattern, failing the test if the builder
+// met an error.
+func buildIO(t testing.TB, builder *IOPatternBuilder) []byte {
+	io, err := builder.Build()
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return io.Bytes()
+}
+
+// whirRound builds the start of the WHIR patterns used in example/main.go.
+func whirRound(io *IOPatternBuilder) *IOPatternBuilder {
+	io.AbsorbScalars(1, "merkle_digest").
+		SqueezeScalars(1, "ood_query").
+		AbsorbScalars(1, "ood_ans").
+		SqueezeScalars(1, "initial_combination_randomness")
+	for range 4 {
+		io.AbsorbScalars(3, "sumcheck_poly").SqueezeScalars(1, "folding_randomness")
+	}
+	return io
+}
+
+func TestIOPatternBuilder(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	bad := NewIOPattern("bad-protocol").
+		SqueezeBytes(8, "first challenge").
+		AbsorbBytes(8, "first reply").
+		SqueezeBytes(16, "second challenge").
+		AbsorbBytes(16, "second reply")
+	assert.Equal(t, badIOPat, string(buildIO(t, bad)))
+
+	keccak := whirRound(NewIOPattern("🌪️").WithCodec(ByteCodec(field))).SqueezeBytes(32, "pow_queries").AbsorbBytes(8, "pow-nonce")
+	assert.Equal(t, "🌪️\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S47initial_combination_randomness"+
+		"\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness"+
+		"\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness"+
+		"\u0000S32pow_queries\u0000A8pow-nonce", string(buildIO(t, keccak)))
+
+	sky := whirRound(NewIOPattern("🌪️").WithCodec(FieldCodec(field))).SqueezeBytes(32, "pow_queries").AbsorbBytes(8, "pow-nonce")
+	assert.Equal(t, "🌪️\u0000A1merkle_digest\u0000S1ood_query\u0000A1ood_ans\u0000S1initial_combination_randomness"+
+		"\u0000A3sumcheck_poly\u0000S1folding_randomness\u0000A3sumcheck_poly\u0000S1folding_randomness"+
+		"\u0000A3sumcheck_poly\u0000S1folding_randomness\u0000A3sumcheck_poly\u0000S1folding_randomness"+
+		"\u0000S3pow_queries\u0000A8pow-nonce", string(buildIO(t, sky)))
+
+	other := NewIOPattern("merlin").WithCodec(FieldCodec(field)).
+		SqueezeBytes(8, "first").
+		SqueezeBytes(20, "second").
+		AbsorbBytes(8, "reply").
+		Hint("hint").
+		Ratchet().
+		AbsorbScalars(2, "scalars").
+		SqueezeEmulatedScalars(2, ecc.BLS12_381.ScalarField(), "challenges")
+	assert.Equal(t, "merlin\u0000S1first\u0000S2second\u0000A8reply\u0000Hhint\u0000R\u0000A2scalars\u0000S8challenges", string(buildIO(t, other)))
+
+	built, err := other.Build()
+	assert.Nil(t, err)
+	parsed := IOPattern{}
+	assert.Nil(t, parsed.Parse(built.Bytes()))
+	assert.Equal(t, built.Ops, parsed.Ops)
+}
+
+var roundTripPatterns = []string{
+	badIOPat,
+	"👩‍💻🥷🏻👨‍💻 building 🔐🔒🗝️\u0000A10first\u0000S10second",
+	"merlin\u0000S1first\u0000S2second\u0000A8reply\u0000Hhint\u0000R\u0000A2scalars\u0000S2challenges",
+	"domain only",
+}
+
+func TestIOPatternBinaryRoundTrip(t *testing.T) {
+	for _, pattern := range roundTripPatterns {
+		io := IOPattern{}
+		assert.Nil(t, io.Parse([]byte(pattern)))
+		encoded, err := io.MarshalBinary()
+		assert.Nil(t, err)
+		assert.Equal(t, pattern, string(encoded))
+		assert.Equal(t, generateTag([]byte(pattern)), generateTag(encoded))
+
+		decoded := IOPattern{Ops: []Op{{Kind: Absorb, Size: 1}}}
+		assert.Nil(t, decoded.UnmarshalBinary(encoded))
+		assert.Equal(t, io, decoded)
+	}
+}
+
+func TestIOPatternJSONRoundTrip(t *testing.T) {
+	for _, pattern := range roundTripPatterns {
+		io := IOPattern{}
+		assert.Nil(t, io.Parse([]byte(pattern)))
+		encoded, err := json.Marshal(&io)
+		assert.Nil(t, err)
+
+		decoded := IOPattern{}
+		assert.Nil(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, pattern, string(decoded.Bytes()))
+	}
+
+	io := IOPattern{}
+	assert.Nil(t, io.Parse([]byte("json\u0000A8reply\u0000R\u0000Hhint")))
+	encoded, err := json.Marshal(&io)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"domainSeparator":"json","ops":[{"kind":"Absorb","size":8,"label":"reply"},{"kind":"Ratchet"},{"kind":"Hint","label":"hint"}]}`, string(encoded))
+
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"ops":[{"kind":"Permute"}]}`), &io), "unknown op kind")
+
+	// JSON patterns that Parse would reject
+	cases := []struct {
+		json   string
+		err    error
+		offset int
+	}{
+		{`{"domainSeparator":"","ops":[]}`, ErrEmptyDomainSeparator, 0},
+		{`{"domainSeparator":"a\u0000b","ops":[]}`, ErrInvalidLabel, 0},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Absorb","label":"x"}]}`, ErrZeroSize, 5},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Absorb","size":1,"label":"x"},{"kind":"Squeeze","size":2,"label":"2nd"}]}`, ErrLabelStartsWithDigit, 10},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Squeeze","size":2,"label":"a\u0000b"}]}`, ErrInvalidLabel, 6},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Ratchet","size":3}]}`, ErrUnexpectedSize, 5},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Ratchet","label":"r"}]}`, ErrUnexpectedLabel, 5},
+		{`{"domainSeparator":"dom","ops":[{"kind":"Hint","size":1,"label":"h"}]}`, ErrUnexpectedSize, 5},
+	}
+	for _, c := range cases {
+		decoded := IOPattern{DomainSeparator: []byte("unchanged")}
+		err := json.Unmarshal([]byte(c.json), &decoded)
+		var parseErr *ParseError
+		if assert.ErrorAs(t, err, &parseErr, c.json) {
+			assert.ErrorIs(t, err, c.err, c.json)
+			assert.Equal(t, c.offset, parseErr.Offset, c.json)
+		}
+		assert.Equal(t, "unchanged", string(decoded.DomainSeparator))
+	}
+	_, err = json.Marshal(&IOPattern{DomainSeparator: []byte{0xff}})
+	assert.ErrorContains(t, err, "not valid UTF-8")
+}
+
+func TestParseRejectsInvalidPatterns(t *testing.T) {
+	cases := []struct {
+		pattern string
+		err     error
+		offset  int
+	}{
+		{"\u0000A1label", ErrEmptyDomainSeparator, 0},
+		{"dom\xff\u0000A1label", ErrInvalidLabel, 0},
+		{"dom\u0000A1x\u0000\u0000S1y", ErrEmptyOp, 8},
+		{"dom\u0000A1x\u0000", ErrEmptyOp, 8},
+		{"dom\u0000X1label", ErrUnknownOpKind, 4},
+		{"dom\u0000A1x\u0000A0label", ErrZeroSize, 9},
+		{"dom\u0000Slabel", ErrZeroSize, 5},
+		{"dom\u0000A18446744073709551616label", ErrSizeOverflow, 5},
+		{"dom\u0000R3", ErrUnexpectedLabel, 5},
+		{"dom\u0000H2nd hint", ErrLabelStartsWithDigit, 5},
+		{"dom\u0000A1la\xfebel", ErrInvalidLabel, 6},
+	}
+	for _, c := range cases {
+		io := IOPattern{}
+		err := io.Parse([]byte(c.pattern))
+		var parseErr *ParseError
+		if assert.ErrorAs(t, err, &parseErr, c.pattern) {
+			assert.ErrorIs(t, err, c.err, c.pattern)
+			assert.Equal(t, c.offset, parseErr.Offset, c.pattern)
+		}
+	}
+
+	io := IOPattern{}
+	assert.Nil(t, io.Parse([]byte("dom\u0000A18446744073709551615label")))
+	assert.Equal(t, uint64(18446744073709551615), io.Ops[0].Size)
+}
+
+func TestIOPatternBuilderRejectsInvalidOps(t *testing.T) {
+	codec := ByteCodec(ecc.BN254.ScalarField())
+	cases := []struct {
+		builder *IOPatternBuilder
+		err     error
+	}{
+		{NewIOPattern(""), ErrEmptyDomainSeparator},
+		{NewIOPattern("a\u0000b"), ErrInvalidLabel},
+		{NewIOPattern("dom").AbsorbBytes(1, "2nd"), ErrLabelStartsWithDigit},
+		{NewIOPattern("dom").Hint("a\u0000b"), ErrInvalidLabel},
+		{NewIOPattern("dom").AbsorbBytes(0, "empty"), ErrZeroSize},
+		{NewIOPattern("dom").SqueezeBytes(-1, "negative"), ErrZeroSize},
+		{NewIOPattern("dom").WithCodec(codec).SqueezeScalars(0, "empty"), ErrZeroSize},
+		{NewIOPattern("dom").AbsorbScalars(1, "scalars"), ErrNoCodec},
+		{NewIOPattern("dom").WithCodec(FieldCodec(big.NewInt(1<<61-1))).SqueezeBytes(8, "small field"), nil},
+	}
+	for i, c := range cases {
+		_, err := c.builder.Build()
+		if c.err == nil {
+			assert.NotNil(t, err, i)
+			continue
+		}
+		assert.ErrorIs(t, err, c.err, i)
+		assert.ErrorIs(t, c.builder.Err(), c.err, i)
+	}
+
+	// the first error sticks
+	builder := NewIOPattern("dom").AbsorbBytes(0, "empty").AbsorbScalars(1, "scalars").Ratchet()
+	assert.ErrorIs(t, builder.Err(), ErrZeroSize)
+}
+
+func TestOpQueueMergesAdjacentOps(t *testing.T) {
+	io := IOPattern{}
+	assert.Nil(t, io.Parse([]byte("dom\u0000A32a\u0000A32b\u0000A32c\u0000S1x\u0000S2y\u0000R\u0000A1d\u0000Hhint\u0000A1e")))
+	assert.Equal(t, 9, len(io.Ops))
+
+	queue := io.GetOpQueue(false)
+	assert.Nil(t, queue.Absorb(40))
+	assert.Nil(t, queue.Absorb(56))
+	assert.ErrorContains(t, queue.Absorb(1), "expected Absorb, got Squeeze x, y")
+	assert.Nil(t, queue.Squeeze(3))
+	assert.Nil(t, queue.Ratchet())
+	assert.ErrorContains(t, queue.Absorb(2), "Absorb size mismatch, have 1, requested 2")
+
+	queue = io.GetOpQueue(true)
+	assert.Nil(t, queue.Absorb(96))
+	assert.Nil(t, queue.Squeeze(3))
+	assert.Nil(t, queue.Ratchet())
+	assert.Nil(t, queue.Absorb(2))
+	assert.Nil(t, queue.Finish())
+}
+
+func TestMerlinAbsorbAcrossOps(t *testing.T) {
+	for _, hashName := range []string{"keccak", "skyscraper"} {
+		pattern := buildIO(t, NewIOPattern("merge").WithCodec(testCodec(hashName)).AbsorbBytes(3, "a").AbsorbBytes(5, "b").SqueezeBytes(16, "c"))
+		data := []byte("absorbed")
+
+		whole, err := newTestMerlin(hashName, pattern)
+		assert.Nil(t, err)
+		assert.Nil(t, whole.AddBytes(data))
+		wholeChallenge := make([]byte, 16)
+		assert.Nil(t, whole.ChallengeBytes(wholeChallenge))
+
+		split, err := newTestMerlin(hashName, pattern)
+		assert.Nil(t, err)
+		assert.Nil(t, split.AddBytes(data[:3]))
+		assert.Nil(t, split.AddBytes(nil))
+		assert.Nil(t, split.AddBytes(data[3:]))
+		splitChallenge := make([]byte, 16)
+		if hashName == "keccak" {
+			assert.Nil(t, split.ChallengeBytes(splitChallenge[:10]))
+			assert.Nil(t, split.ChallengeBytes(splitChallenge[10:]))
+		} else {
+			// field sponges squeeze whole elements per call
+			assert.Nil(t, split.ChallengeBytes(splitChallenge))
+		}
+
+		assert.Equal(t, wholeChallenge, splitChallenge, hashName)
+		assert.Equal(t, whole.Transcript(), split.Transcript(), hashName)
+	}
+}
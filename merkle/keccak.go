@@ -0,0 +1,101 @@
+package merkle
+
+import (
+	"encoding/binary"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/uints"
+	sha3native "golang.org/x/crypto/sha3"
+)
+
+// KeccakDigestSize is the size of a Keccak-256 digest.
+const KeccakDigestSize = 32
+
+// Keccak hashes trees like WHIR's keccak merkle config: a leaf is the
+// Keccak-256 of its arkworks compressed serialization, i.e. a little-endian
+// u64 length followed by each element in little-endian bytes, and a parent is
+// the Keccak-256 of its children's concatenation.
+type Keccak struct {
+	api frontend.API
+}
+
+func NewKeccak(api frontend.API) *Keccak {
+	return &Keccak{api}
+}
+
+func (k *Keccak) sum(data []uints.U8) ([]uints.U8, error) {
+	hasher, err := sha3.NewLegacyKeccak256(k.api)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(data)
+	return hasher.Sum(), nil
+}
+
+func (k *Keccak) HashLeaf(leaf []frontend.Variable) ([]uints.U8, error) {
+	fieldBits := k.api.Compiler().FieldBitLen()
+	elementBytes := (fieldBits + 7) / 8
+	data := uints.NewU8Array(binary.LittleEndian.AppendUint64(nil, uint64(len(leaf))))
+	for _, v := range leaf {
+		leBits := bits.ToBinary(k.api, v, bits.WithNbDigits(fieldBits))
+		for len(leBits) < 8*elementBytes {
+			leBits = append(leBits, 0)
+		}
+		for i := range elementBytes {
+			data = append(data, uints.U8{Val: bits.FromBinary(k.api, leBits[8*i:8*i+8])})
+		}
+	}
+	return k.sum(data)
+}
+
+func (k *Keccak) Compress(left, right []uints.U8) ([]uints.U8, error) {
+	return k.sum(append(append([]uints.U8{}, left...), right...))
+}
+
+func (k *Keccak) Select(selector frontend.Variable, a, b []uints.U8) []uints.U8 {
+	result := make([]uints.U8, len(a))
+	for i := range a {
+		result[i] = uints.U8{Val: k.api.Select(selector, a[i].Val, b[i].Val)}
+	}
+	return result
+}
+
+func (k *Keccak) AssertIsEqual(a, b []uints.U8) {
+	for i := range a {
+		k.api.AssertIsEqual(a[i].Val, b[i].Val)
+	}
+}
+
+func (k *Keccak) DigestSize() int {
+	return KeccakDigestSize
+}
+
+func (k *Keccak) DigestFromBytes(bytes []uints.U8) []uints.U8 {
+	return bytes
+}
+
+// KeccakLeafHash is the native counterpart of Keccak.HashLeaf for BN254
+// scalars.
+func KeccakLeafHash(leaf []fr.Element) []byte {
+	h := sha3native.NewLegacyKeccak256()
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(leaf))))
+	for _, v := range leaf {
+		b := v.Bytes()
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		h.Write(b[:])
+	}
+	return h.Sum(nil)
+}
+
+// KeccakCompress is the native counterpart of Keccak.Compress.
+func KeccakCompress(left, right []byte) []byte {
+	h := sha3native.NewLegacyKeccak256()
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
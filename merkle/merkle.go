@@ -0,0 +1,246 @@
+// Package merkle verifies openings of the Merkle trees WHIR commits to,
+// following the arkworks merkle_tree conventions: leaves are hashed with a
+// leaf hash, and every parent is the two-to-one compression of its left and
+// right children.
+package merkle
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/uints"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+)
+
+// Hasher is the in-circuit hash of a tree with digests of type D.
+type Hasher[D any] interface {
+	HashLeaf(leaf []frontend.Variable) (D, error)
+	Compress(left, right D) (D, error)
+	// Select returns a if selector is 1 and b if it is 0.
+	Select(selector frontend.Variable, a, b D) D
+	AssertIsEqual(a, b D)
+	// DigestSize is the number of bytes a digest takes in a hint.
+	DigestSize() int
+	DigestFromBytes(bytes []uints.U8) D
+}
+
+// Path is the opening of a single leaf: the sibling of the leaf and the
+// siblings of its ancestors, ordered from the root down as in arkworks.
+type Path[D any] struct {
+	LeafIndex       int
+	LeafSiblingHash D
+	AuthPath        []D
+}
+
+// MultiPath is the arkworks compressed opening of several leaves. Each
+// authentication path is stored as the length of the prefix it shares with
+// the previous path and the remaining suffix.
+type MultiPath[D any] struct {
+	LeafSiblingHashes      []D
+	AuthPathsPrefixLengths []int
+	AuthPathsSuffixes      [][]D
+	LeafIndexes            []int
+}
+
+// Decompress expands the multi path into one path per leaf.
+func (m *MultiPath[D]) Decompress() ([]Path[D], error) {
+	n := len(m.LeafIndexes)
+	if len(m.LeafSiblingHashes) != n || len(m.AuthPathsPrefixLengths) != n || len(m.AuthPathsSuffixes) != n {
+		return nil, fmt.Errorf("multi path has inconsistent lengths")
+	}
+	paths := make([]Path[D], n)
+	var previous []D
+	for i := range n {
+		prefix := m.AuthPathsPrefixLengths[i]
+		if prefix > len(previous) {
+			return nil, fmt.Errorf("multi path %d shares %d nodes with a path of %d", i, prefix, len(previous))
+		}
+		authPath := append(append([]D{}, previous[:prefix]...), m.AuthPathsSuffixes[i]...)
+		paths[i] = Path[D]{LeafIndex: m.LeafIndexes[i], LeafSiblingHash: m.LeafSiblingHashes[i], AuthPath: authPath}
+		previous = authPath
+	}
+	return paths, nil
+}
+
+// NewMultiPath compresses the paths of distinct leaves in increasing order
+// like arkworks' generate_multi_proof: each authentication path only keeps
+// the suffix that differs from the previous one.
+func NewMultiPath[D any](paths []Path[D], equal func(a, b D) bool) MultiPath[D] {
+	var m MultiPath[D]
+	var previous []D
+	for _, path := range paths {
+		prefix := 0
+		for prefix < min(len(previous), len(path.AuthPath)) && equal(previous[prefix], path.AuthPath[prefix]) {
+			prefix++
+		}
+		m.LeafSiblingHashes = append(m.LeafSiblingHashes, path.LeafSiblingHash)
+		m.AuthPathsPrefixLengths = append(m.AuthPathsPrefixLengths, prefix)
+		m.AuthPathsSuffixes = append(m.AuthPathsSuffixes, path.AuthPath[prefix:])
+		m.LeafIndexes = append(m.LeafIndexes, path.LeafIndex)
+		previous = path.AuthPath
+	}
+	return m
+}
+
+// EncodeMultiPath serializes the multi path like arkworks' compressed
+// CanonicalSerialize, which is the hint read by VerifyMultiPath: every vector
+// and every index is preceded by or written as a little-endian u64.
+func EncodeMultiPath[D any](m MultiPath[D], encode func(D) []byte) []byte {
+	result := binary.LittleEndian.AppendUint64(nil, uint64(len(m.LeafSiblingHashes)))
+	for _, node := range m.LeafSiblingHashes {
+		result = append(result, encode(node)...)
+	}
+	result = binary.LittleEndian.AppendUint64(result, uint64(len(m.AuthPathsPrefixLengths)))
+	for _, prefix := range m.AuthPathsPrefixLengths {
+		result = binary.LittleEndian.AppendUint64(result, uint64(prefix))
+	}
+	result = binary.LittleEndian.AppendUint64(result, uint64(len(m.AuthPathsSuffixes)))
+	for _, suffix := range m.AuthPathsSuffixes {
+		result = binary.LittleEndian.AppendUint64(result, uint64(len(suffix)))
+		for _, node := range suffix {
+			result = append(result, encode(node)...)
+		}
+	}
+	result = binary.LittleEndian.AppendUint64(result, uint64(len(m.LeafIndexes)))
+	for _, index := range m.LeafIndexes {
+		result = binary.LittleEndian.AppendUint64(result, uint64(index))
+	}
+	return result
+}
+
+// multiPathHintSize is the size of the encoding of a multi path with the given
+// prefix lengths in a tree of the given depth.
+func multiPathHintSize(depth, digestSize int, prefixLengths []int) int {
+	n := len(prefixLengths)
+	size := 4*8 + n*digestSize + 2*n*8
+	for _, prefix := range prefixLengths {
+		size += 8 + (depth-1-prefix)*digestSize
+	}
+	return size
+}
+
+// hintReader splits a hint into its fields.
+type hintReader struct {
+	api   frontend.API
+	bytes []uints.U8
+}
+
+func (r *hintReader) next(n int) []uints.U8 {
+	bytes := r.bytes[:n]
+	r.bytes = r.bytes[n:]
+	return bytes
+}
+
+// assertUint64 reads a little-endian u64 and constrains it to value.
+func (r *hintReader) assertUint64(value uint64) {
+	for i, b := range r.next(8) {
+		r.api.AssertIsEqual(b.Val, byte(value>>(8*i)))
+	}
+}
+
+// assertIndex reads a little-endian u64 and constrains it to the index of
+// the given little-endian bits, byte by byte so that no byte can carry into
+// the next.
+func (r *hintReader) assertIndex(indexBits []frontend.Variable) {
+	for i, b := range r.next(8) {
+		byteBits := make([]frontend.Variable, 8)
+		for j := range byteBits {
+			byteBits[j] = 0
+			if 8*i+j < len(indexBits) {
+				byteBits[j] = indexBits[8*i+j]
+			}
+		}
+		r.api.AssertIsEqual(b.Val, bits.FromBinary(r.api, byteBits))
+	}
+}
+
+// VerifyMultiPath reads the arkworks multi path opening the given leaves from
+// a single transcript hint, encoded as by EncodeMultiPath, and checks it
+// against the root of a tree with 2^depth leaves. The leaves must be distinct
+// and in increasing order, each index given by its depth little-endian bits
+// as returned by Arthur.FillChallengeIndices. The prefix lengths of the multi
+// path depend on the values of the tree, so the circuit is compiled for those
+// of the proof and checks them.
+func VerifyMultiPath[D any](api frontend.API, arthur gnark_nimue.Arthur, hasher Hasher[D], root D, depth int, indexBits [][]frontend.Variable, leaves [][]frontend.Variable, prefixLengths []int) error {
+	if depth < 1 {
+		return fmt.Errorf("tree depth must be positive, got %d", depth)
+	}
+	n := len(leaves)
+	if len(indexBits) != n || len(prefixLengths) != n {
+		return fmt.Errorf("got %d indices and %d prefix lengths for %d leaves", len(indexBits), len(prefixLengths), n)
+	}
+	for i, prefix := range prefixLengths {
+		shared := depth - 1
+		if i == 0 {
+			shared = 0
+		}
+		if prefix < 0 || prefix > shared {
+			return fmt.Errorf("multi path %d shares %d nodes with a path of %d", i, prefix, shared)
+		}
+	}
+	size := hasher.DigestSize()
+	hint := make([]uints.U8, multiPathHintSize(depth, size, prefixLengths))
+	err := arthur.FillNextHint(hint)
+	if err != nil {
+		return err
+	}
+	r := hintReader{api, hint}
+	readNode := func() D {
+		return hasher.DigestFromBytes(r.next(size))
+	}
+
+	r.assertUint64(uint64(n))
+	siblings := make([]D, n)
+	for i := range siblings {
+		siblings[i] = readNode()
+	}
+	r.assertUint64(uint64(n))
+	for _, prefix := range prefixLengths {
+		r.assertUint64(uint64(prefix))
+	}
+	r.assertUint64(uint64(n))
+	authPaths := make([][]D, n)
+	for i, prefix := range prefixLengths {
+		r.assertUint64(uint64(depth - 1 - prefix))
+		authPaths[i] = make([]D, 0, depth-1)
+		if i > 0 {
+			authPaths[i] = append(authPaths[i], authPaths[i-1][:prefix]...)
+		}
+		for len(authPaths[i]) < depth-1 {
+			authPaths[i] = append(authPaths[i], readNode())
+		}
+	}
+	r.assertUint64(uint64(n))
+	for i := range indexBits {
+		if len(indexBits[i]) != depth {
+			return fmt.Errorf("index %d has %d bits, expected %d", i, len(indexBits[i]), depth)
+		}
+		r.assertIndex(indexBits[i])
+	}
+
+	for i, leaf := range leaves {
+		current, err := hasher.HashLeaf(leaf)
+		if err != nil {
+			return err
+		}
+		// the authentication path goes from the root down, so it is walked
+		// in reverse after the leaf sibling
+		for level := range depth {
+			sibling := siblings[i]
+			if level > 0 {
+				sibling = authPaths[i][depth-1-level]
+			}
+			isRight := indexBits[i][level]
+			left := hasher.Select(isRight, sibling, current)
+			right := hasher.Select(isRight, current, sibling)
+			current, err = hasher.Compress(left, right)
+			if err != nil {
+				return err
+			}
+		}
+		hasher.AssertIsEqual(current, root)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package merkle
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testDepth   = 3
+	testQueries = 4
+)
+
+type tree[D any] struct {
+	levels [][]D
+}
+
+func buildTree[D any](leaves [][]fr.Element, leafHash func([]fr.Element) D, compress func(D, D) D) tree[D] {
+	level := make([]D, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = leafHash(leaf)
+	}
+	levels := [][]D{level}
+	for len(level) > 1 {
+		next := make([]D, len(level)/2)
+		for i := range next {
+			next[i] = compress(level[2*i], level[2*i+1])
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return tree[D]{levels}
+}
+
+func (t tree[D]) root() D {
+	return t.levels[len(t.levels)-1][0]
+}
+
+func (t tree[D]) path(index int) Path[D] {
+	var authPath []D
+	for level := len(t.levels) - 2; level > 0; level-- {
+		authPath = append(authPath, t.levels[level][(index>>level)^1])
+	}
+	return Path[D]{LeafIndex: index, LeafSiblingHash: t.levels[0][index^1], AuthPath: authPath}
+}
+
+func testLeaves() [][]fr.Element {
+	leaves := make([][]fr.Element, 1<<testDepth)
+	for i := range leaves {
+		leaves[i] = make([]fr.Element, 2)
+		leaves[i][0].SetUint64(uint64(3 * i))
+		leaves[i][1].SetUint64(uint64(3*i + 1))
+	}
+	return leaves
+}
+
+func TestMultiPathDecompress(t *testing.T) {
+	leaves := make([][]fr.Element, 16)
+	for i := range leaves {
+		leaves[i] = []fr.Element{fr.NewElement(uint64(i))}
+	}
+	tr := buildTree(leaves, KeccakLeafHash, KeccakCompress)
+	var paths []Path[[]byte]
+	for _, index := range []int{1, 3, 8, 14} {
+		paths = append(paths, tr.path(index))
+	}
+	multi := NewMultiPath(paths, bytes.Equal)
+	assert.Equal(t, []int{0, 2, 0, 1}, multi.AuthPathsPrefixLengths)
+	assert.Equal(t, []int{1, 3, 8, 14}, multi.LeafIndexes)
+
+	decompressed, err := multi.Decompress()
+	assert.Nil(t, err)
+	assert.Equal(t, paths, decompressed)
+
+	multi.AuthPathsPrefixLengths[0] = 1
+	_, err = multi.Decompress()
+	assert.NotNil(t, err)
+}
+
+type merkleCircuit struct {
+	IO            []byte
+	Hash          string
+	PrefixLengths []int
+	Transcript    []uints.U8
+	Root          []uints.U8
+	Leaves        [][2]frontend.Variable
+}
+
+func (circuit *merkleCircuit) Define(api frontend.API) error {
+	var arthur gnark_nimue.Arthur
+	var err error
+	if circuit.Hash == "skyscraper" {
+		arthur, err = gnark_nimue.NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), circuit.IO, circuit.Transcript, false)
+	} else {
+		arthur, err = gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+	}
+	if err != nil {
+		return err
+	}
+	_, indexBits, err := arthur.FillChallengeIndices(testQueries, len(circuit.Leaves), testDepth)
+	if err != nil {
+		return err
+	}
+	leaves := make([][]frontend.Variable, len(circuit.Leaves))
+	for i := range leaves {
+		leaves[i] = circuit.Leaves[i][:]
+	}
+	if circuit.Hash == "skyscraper" {
+		hasher := NewSkyscraper(api, skyscraper.NewSkyscraper(api, 2))
+		err = VerifyMultiPath(api, arthur, hasher, hasher.DigestFromBytes(circuit.Root), testDepth, indexBits, leaves, circuit.PrefixLengths)
+	} else {
+		hasher := NewKeccak(api)
+		err = VerifyMultiPath(api, arthur, hasher, hasher.DigestFromBytes(circuit.Root), testDepth, indexBits, leaves, circuit.PrefixLengths)
+	}
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+func checkVerifyMultiPath[D any](t *testing.T, hashName string, tr tree[D], encode func(D) []byte, equal func(a, b D) bool) {
+	codec := gnark_nimue.ByteCodec(ecc.BN254.ScalarField())
+	if hashName == "skyscraper" {
+		codec = gnark_nimue.FieldCodec(ecc.BN254.ScalarField())
+	}
+	ioPattern, err := gnark_nimue.NewIOPattern("merkle").WithCodec(codec).SqueezeBytes(testQueries, "stir_queries").Hint("merkle_proof").Build()
+	assert.Nil(t, err)
+	io := ioPattern.Bytes()
+	newMerlin := func() gnark_nimue.Merlin {
+		merlin, err := gnark_nimue.NewKeccakMerlin(ecc.BN254.ScalarField(), io, false)
+		if hashName == "skyscraper" {
+			merlin, err = gnark_nimue.NewSkyscraperMerlin(io, false)
+		}
+		assert.Nil(t, err)
+		return merlin
+	}
+	merlin := newMerlin()
+	challenge := make([]byte, testQueries)
+	assert.Nil(t, merlin.ChallengeBytes(challenge))
+	indices := make([]int, testQueries)
+	for i, b := range challenge {
+		indices[i] = int(b) % (1 << testDepth)
+	}
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+	leaves := testLeaves()
+	paths := make([]Path[D], len(indices))
+	for i, index := range indices {
+		paths[i] = tr.path(index)
+	}
+	multi := NewMultiPath(paths, equal)
+	assert.Nil(t, merlin.AddHint(EncodeMultiPath(multi, encode)))
+	transcript := merlin.Transcript()
+
+	check := func(prefixLengths []int, transcript []byte, leaves [][]fr.Element) error {
+		circuit := merkleCircuit{IO: io, Hash: hashName, PrefixLengths: prefixLengths, Transcript: make([]uints.U8, len(transcript)), Root: make([]uints.U8, len(encode(tr.root()))), Leaves: make([][2]frontend.Variable, len(indices))}
+		assignment := merkleCircuit{IO: io, Hash: hashName, PrefixLengths: prefixLengths, Transcript: uints.NewU8Array(transcript), Root: uints.NewU8Array(encode(tr.root())), Leaves: make([][2]frontend.Variable, len(indices))}
+		for i, index := range indices {
+			assignment.Leaves[i] = [2]frontend.Variable{leaves[index][0], leaves[index][1]}
+		}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	assert.Nil(t, check(multi.AuthPathsPrefixLengths, transcript, leaves))
+
+	wrongLeaves := testLeaves()
+	wrongLeaves[indices[0]][1].SetUint64(12345)
+	assert.NotNil(t, check(multi.AuthPathsPrefixLengths, transcript, wrongLeaves))
+
+	// the hint carries the leaf indexes, which must be the queried ones
+	tampered := slices.Clone(transcript)
+	tampered[len(tampered)-8]++
+	assert.NotNil(t, check(multi.AuthPathsPrefixLengths, tampered, leaves))
+
+	// the full paths with no shared prefix are not the encoding of the proof
+	full := make([]int, len(indices))
+	unshared := NewMultiPath(paths, func(a, b D) bool { return false })
+	merlin = newMerlin()
+	assert.Nil(t, merlin.ChallengeBytes(challenge))
+	assert.Nil(t, merlin.AddHint(EncodeMultiPath(unshared, encode)))
+	assert.Nil(t, check(full, merlin.Transcript(), leaves))
+	assert.NotEqual(t, full, multi.AuthPathsPrefixLengths)
+	assert.NotNil(t, check(full, transcript, leaves))
+}
+
+func TestKeccakVerifyMultiPath(t *testing.T) {
+	tr := buildTree(testLeaves(), KeccakLeafHash, KeccakCompress)
+	checkVerifyMultiPath(t, "keccak", tr, func(d []byte) []byte { return d }, bytes.Equal)
+}
+
+func TestSkyscraperVerifyMultiPath(t *testing.T) {
+	tr := buildTree(testLeaves(), SkyscraperLeafHash, SkyscraperCompress)
+	checkVerifyMultiPath(t, "skyscraper", tr, EncodeSkyscraperDigest, func(a, b fr.Element) bool { return a == b })
+}
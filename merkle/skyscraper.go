@@ -0,0 +1,87 @@
+package merkle
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/reilabs/gnark-nimue/hash"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+)
+
+// SkyscraperDigestSize is the size of a BN254 digest in a hint, stored in
+// little-endian bytes.
+const SkyscraperDigestSize = 32
+
+// Skyscraper hashes trees of BN254 elements with the Skyscraper v2
+// compression function, the permutation of the Skyscraper sponge: a parent is
+// compress(left, right) and a leaf is folded from zero with
+// acc = compress(acc, element).
+type Skyscraper struct {
+	api frontend.API
+	sc  *skyscraper.Skyscraper
+}
+
+func NewSkyscraper(api frontend.API, sc *skyscraper.Skyscraper) *Skyscraper {
+	return &Skyscraper{api, sc}
+}
+
+func (s *Skyscraper) HashLeaf(leaf []frontend.Variable) (frontend.Variable, error) {
+	acc := frontend.Variable(0)
+	for _, v := range leaf {
+		acc = s.sc.CompressV2(acc, v)
+	}
+	return acc, nil
+}
+
+func (s *Skyscraper) Compress(left, right frontend.Variable) (frontend.Variable, error) {
+	return s.sc.CompressV2(left, right), nil
+}
+
+func (s *Skyscraper) Select(selector frontend.Variable, a, b frontend.Variable) frontend.Variable {
+	return s.api.Select(selector, a, b)
+}
+
+func (s *Skyscraper) AssertIsEqual(a, b frontend.Variable) {
+	s.api.AssertIsEqual(a, b)
+}
+
+func (s *Skyscraper) DigestSize() int {
+	return SkyscraperDigestSize
+}
+
+// DigestFromBytes packs little-endian bytes into a field element. Encodings
+// that are not canonical wrap around, which still determines a unique digest.
+func (s *Skyscraper) DigestFromBytes(bytes []uints.U8) frontend.Variable {
+	result := frontend.Variable(0)
+	for i := len(bytes) - 1; i >= 0; i-- {
+		result = s.api.Add(s.api.Mul(result, 256), bytes[i].Val)
+	}
+	return result
+}
+
+// SkyscraperCompress is the native counterpart of Skyscraper.Compress.
+func SkyscraperCompress(left, right fr.Element) fr.Element {
+	state := [2]fr.Element{left, right}
+	hash.NativeSkyscraperPermute(&state)
+	var result fr.Element
+	result.Add(&state[0], &left)
+	return result
+}
+
+// SkyscraperLeafHash is the native counterpart of Skyscraper.HashLeaf.
+func SkyscraperLeafHash(leaf []fr.Element) fr.Element {
+	var acc fr.Element
+	for _, v := range leaf {
+		acc = SkyscraperCompress(acc, v)
+	}
+	return acc
+}
+
+// EncodeSkyscraperDigest serializes a digest for EncodeMultiPath.
+func EncodeSkyscraperDigest(d fr.Element) []byte {
+	b := d.Bytes()
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b[:]
+}
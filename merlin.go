@@ -0,0 +1,283 @@
+package gnark_nimue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/reilabs/gnark-nimue/hash"
+)
+
+// Merlin is the out-of-circuit prover side of a transcript. Every challenge it
+// produces is the same value the matching Arthur derives in-circuit for the
+// same IO pattern and transcript.
+type Merlin interface {
+	AddBytes(bytes []byte) error
+	AddScalars(scalars []*big.Int) error
+	ChallengeBytes(out []byte) error
+	ChallengeScalars(out []*big.Int) error
+	AddHint(hint []byte) error
+	Ratchet() error
+	Finish() error
+	Transcript() []byte
+}
+
+func scalarToBytesLE(field *big.Int, scalar *big.Int) ([]byte, error) {
+	if scalar.Sign() < 0 || scalar.Cmp(field) >= 0 {
+		return nil, fmt.Errorf("scalar %s is not a canonical field element", scalar)
+	}
+	out := make([]byte, (field.BitLen()+7)/8)
+	scalar.FillBytes(out)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// appendHint writes hint to the transcript with nimue's u32 little-endian
+// length prefix.
+func appendHint(transcript []byte, hint []byte) []byte {
+	transcript = binary.LittleEndian.AppendUint32(transcript, uint32(len(hint)))
+	return append(transcript, hint...)
+}
+
+type byteMerlin[H hash.DuplexHash[byte]] struct {
+	field      *big.Int
+	transcript []byte
+	safe       *Safe[byte, H]
+}
+
+func NewByteMerlin[S hash.DuplexHash[byte]](field *big.Int, io []byte, hash S, ignoreHints bool) (Merlin, error) {
+	safe, err := NewSafe[byte, S](hash, io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	return &byteMerlin[S]{
+		field,
+		nil,
+		safe,
+	}, nil
+}
+
+func NewKeccakMerlin(field *big.Int, io []byte, ignoreHints bool) (Merlin, error) {
+	return NewByteMerlin[hash.NativeKeccak](field, io, hash.NewNativeKeccak(), ignoreHints)
+}
+
+func (merlin *byteMerlin[H]) AddBytes(bytes []byte) error {
+	err := merlin.safe.Absorb(bytes)
+	if err != nil {
+		return err
+	}
+	merlin.transcript = append(merlin.transcript, bytes...)
+	return nil
+}
+
+func (merlin *byteMerlin[H]) ChallengeBytes(out []byte) error {
+	return merlin.safe.Squeeze(out)
+}
+
+func (merlin *byteMerlin[H]) AddScalars(scalars []*big.Int) error {
+	for _, s := range scalars {
+		bytes, err := scalarToBytesLE(merlin.field, s)
+		if err != nil {
+			return err
+		}
+		err = merlin.AddBytes(bytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (merlin *byteMerlin[H]) ChallengeScalars(out []*big.Int) error {
+	bytes := make([]byte, (merlin.field.BitLen()+128)/8)
+	for i := range out {
+		err := merlin.ChallengeBytes(bytes)
+		if err != nil {
+			return err
+		}
+		out[i] = new(big.Int).SetBytes(bytes)
+		out[i].Mod(out[i], merlin.field)
+	}
+	return nil
+}
+
+func (merlin *byteMerlin[H]) AddHint(hint []byte) error {
+	err := merlin.safe.Hint()
+	if err != nil {
+		return err
+	}
+	merlin.transcript = appendHint(merlin.transcript, hint)
+	return nil
+}
+
+func (merlin *byteMerlin[H]) Ratchet() error {
+	return merlin.safe.Ratchet()
+}
+
+func (merlin *byteMerlin[H]) Finish() error {
+	return merlin.safe.Finish()
+}
+
+func (merlin *byteMerlin[H]) Transcript() []byte {
+	return merlin.transcript
+}
+
+type nativeMerlin[H hash.DuplexHash[fr.Element]] struct {
+	transcript []byte
+	safe       *Safe[fr.Element, H]
+}
+
+func newNativeMerlin[H hash.DuplexHash[fr.Element]](sponge H, io []byte, ignoreHints bool) (Merlin, error) {
+	safe, err := NewSafe[fr.Element, H](sponge, io, ignoreHints)
+	if err != nil {
+		return nil, err
+	}
+	return &nativeMerlin[H]{nil, safe}, nil
+}
+
+func NewSkyscraperMerlin(io []byte, ignoreHints bool) (Merlin, error) {
+	return newNativeMerlin[hash.NativeSkyscraper](hash.NewNativeSkyscraper(), io, ignoreHints)
+}
+
+func NewPoseidon2Merlin(io []byte, ignoreHints bool) (Merlin, error) {
+	return newNativeMerlin[hash.NativePoseidon2](hash.NewNativePoseidon2(), io, ignoreHints)
+}
+
+func (merlin *nativeMerlin[H]) AddBytes(bytes []byte) error {
+	// one field element per byte, absorbed in a single call as by
+	// nativeArthur.FillNextBytes
+	if len(bytes) > 0 {
+		elements := make([]fr.Element, len(bytes))
+		for i, b := range bytes {
+			elements[i].SetUint64(uint64(b))
+		}
+		err := merlin.safe.Absorb(elements)
+		if err != nil {
+			return err
+		}
+	}
+	merlin.transcript = append(merlin.transcript, bytes...)
+	return nil
+}
+
+func (merlin *nativeMerlin[H]) ChallengeBytes(out []byte) error {
+	if len(out) == 0 {
+		return nil
+	}
+	numBytes, err := randomBytesInField(ecc.BN254.ScalarField())
+	if err != nil {
+		return err
+	}
+	lenGood := min(len(out), numBytes)
+	tmp := make([]*big.Int, 1)
+	for i := 0; i < len(out); i += lenGood {
+		err = merlin.ChallengeScalars(tmp)
+		if err != nil {
+			return err
+		}
+		bytes, _ := scalarToBytesLE(ecc.BN254.ScalarField(), tmp[0])
+		copy(out[i:min(i+lenGood, len(out))], bytes)
+	}
+	return nil
+}
+
+func (merlin *nativeMerlin[H]) AddScalars(scalars []*big.Int) error {
+	elems := make([]fr.Element, len(scalars))
+	var bytes []byte
+	for i, s := range scalars {
+		b, err := scalarToBytesLE(ecc.BN254.ScalarField(), s)
+		if err != nil {
+			return err
+		}
+		elems[i].SetBigInt(s)
+		bytes = append(bytes, b...)
+	}
+	err := merlin.safe.Absorb(elems)
+	if err != nil {
+		return err
+	}
+	merlin.transcript = append(merlin.transcript, bytes...)
+	return nil
+}
+
+// addUnits absorbs units, which the transcript stores as bytes.
+func (merlin *nativeMerlin[H]) addUnits(units []*big.Int, bytes []byte) error {
+	elems := make([]fr.Element, len(units))
+	for i, u := range units {
+		elems[i].SetBigInt(u)
+	}
+	err := merlin.safe.Absorb(elems)
+	if err != nil {
+		return err
+	}
+	merlin.transcript = append(merlin.transcript, bytes...)
+	return nil
+}
+
+func (merlin *nativeMerlin[H]) ChallengeScalars(out []*big.Int) error {
+	elems := make([]fr.Element, len(out))
+	err := merlin.safe.Squeeze(elems)
+	if err != nil {
+		return err
+	}
+	for i := range elems {
+		out[i] = elems[i].BigInt(new(big.Int))
+	}
+	return nil
+}
+
+func (merlin *nativeMerlin[H]) AddHint(hint []byte) error {
+	err := merlin.safe.Hint()
+	if err != nil {
+		return err
+	}
+	merlin.transcript = appendHint(merlin.transcript, hint)
+	return nil
+}
+
+func (merlin *nativeMerlin[H]) Ratchet() error {
+	return merlin.safe.Ratchet()
+}
+
+func (merlin *nativeMerlin[H]) Finish() error {
+	return merlin.safe.Finish()
+}
+
+func (merlin *nativeMerlin[H]) Transcript() []byte {
+	return merlin.transcript
+}
+
+// AddEmulatedScalars writes scalars of a field other than the proof system's
+// field, matching FillNextEmulatedScalars.
+func AddEmulatedScalars(merlin Merlin, modulus *big.Int, scalars []*big.Int) error {
+	for _, s := range scalars {
+		bytes, err := scalarToBytesLE(modulus, s)
+		if err != nil {
+			return err
+		}
+		err = merlin.AddBytes(bytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChallengeEmulatedScalars derives challenges in a field other than the proof
+// system's field, matching FillChallengeEmulatedScalars.
+func ChallengeEmulatedScalars(merlin Merlin, modulus *big.Int, out []*big.Int) error {
+	bytes := make([]byte, (modulus.BitLen()+128)/8)
+	for i := range out {
+		err := merlin.ChallengeBytes(bytes)
+		if err != nil {
+			return err
+		}
+		out[i] = new(big.Int).SetBytes(bytes)
+		out[i].Mod(out[i], modulus)
+	}
+	return nil
+}
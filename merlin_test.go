@@ -0,0 +1,262 @@
+package gnark_nimue
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/reilabs/gnark-nimue/hash"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeccakMerlinMatchesNimue(t *testing.T) {
+	merlin, err := NewKeccakMerlin(ecc.BN254.ScalarField(), []byte(badIOPat), false)
+	assert.Nil(t, err)
+
+	firstChallenge := make([]byte, 8)
+	assert.Nil(t, merlin.ChallengeBytes(firstChallenge))
+	assert.Nil(t, merlin.AddBytes(firstChallenge))
+	secondChallenge := make([]byte, 16)
+	assert.Nil(t, merlin.ChallengeBytes(secondChallenge))
+	assert.Nil(t, merlin.AddBytes(secondChallenge))
+
+	assert.Equal(t, badTranscript, merlin.Transcript())
+}
+
+func TestMerlinRejectsUnexpectedOps(t *testing.T) {
+	merlin, err := NewKeccakMerlin(ecc.BN254.ScalarField(), []byte("proto\u0000A8reply"), false)
+	assert.Nil(t, err)
+	assert.NotNil(t, merlin.ChallengeBytes(make([]byte, 8)))
+	assert.NotNil(t, merlin.AddScalars([]*big.Int{ecc.BN254.ScalarField()}))
+}
+
+// newTestArthur creates an Arthur for the sponge named by hashName.
+func newTestArthur(api frontend.API, hashName string, io []byte, transcript []uints.U8, opts ...ArthurOption) (Arthur, error) {
+	switch hashName {
+	case "skyscraper":
+		return NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), io, transcript, false, opts...)
+	case "poseidon2":
+		return NewPoseidon2Arthur(api, io, transcript, false, opts...)
+	}
+	return NewKeccakArthur(api, io, transcript, false, opts...)
+}
+
+func newTestMerlin(hashName string, io []byte) (Merlin, error) {
+	switch hashName {
+	case "skyscraper":
+		return NewSkyscraperMerlin(io, false)
+	case "poseidon2":
+		return NewPoseidon2Merlin(io, false)
+	}
+	return NewKeccakMerlin(ecc.BN254.ScalarField(), io, false)
+}
+
+func newTestNativeArthur(hashName string, io []byte, transcript []byte) (NativeArthur, error) {
+	switch hashName {
+	case "skyscraper":
+		return NewSkyscraperNativeArthur(io, transcript, false)
+	case "poseidon2":
+		return NewPoseidon2NativeArthur(io, transcript, false)
+	}
+	return NewKeccakNativeArthur(ecc.BN254.ScalarField(), io, transcript, false)
+}
+
+func testCodec(hashName string) Codec {
+	if hashName == "keccak" {
+		return ByteCodec(ecc.BN254.ScalarField())
+	}
+	return FieldCodec(ecc.BN254.ScalarField())
+}
+
+type merlinCircuit struct {
+	IO         []byte
+	Hash       string
+	Transcript []uints.U8
+	Bytes      []frontend.Variable
+	Reply      []frontend.Variable
+	Hint       []frontend.Variable
+	Scalars    []frontend.Variable
+	Challenges []frontend.Variable
+}
+
+func (circuit *merlinCircuit) Define(api frontend.API) error {
+	arthur, err := newTestArthur(api, circuit.Hash, circuit.IO, circuit.Transcript)
+	if err != nil {
+		return err
+	}
+
+	first := make([]uints.U8, 8)
+	if err = arthur.FillChallengeBytes(first); err != nil {
+		return err
+	}
+	second := make([]uints.U8, 20)
+	if err = arthur.FillChallengeBytes(second); err != nil {
+		return err
+	}
+	for i, b := range append(first, second...) {
+		api.AssertIsEqual(b.Val, circuit.Bytes[i])
+	}
+
+	reply := make([]uints.U8, len(circuit.Reply))
+	if err = arthur.FillNextBytes(reply); err != nil {
+		return err
+	}
+	for i := range reply {
+		api.AssertIsEqual(reply[i].Val, circuit.Reply[i])
+	}
+	hint := make([]uints.U8, len(circuit.Hint))
+	if err = arthur.FillNextHint(hint); err != nil {
+		return err
+	}
+	for i := range hint {
+		api.AssertIsEqual(hint[i].Val, circuit.Hint[i])
+	}
+	if err = arthur.Ratchet(); err != nil {
+		return err
+	}
+
+	scalars := make([]frontend.Variable, len(circuit.Scalars))
+	if err = arthur.FillNextScalars(scalars); err != nil {
+		return err
+	}
+	for i := range scalars {
+		api.AssertIsEqual(scalars[i], circuit.Scalars[i])
+	}
+
+	challenges := make([]frontend.Variable, len(circuit.Challenges))
+	if err = arthur.FillChallengeScalars(challenges); err != nil {
+		return err
+	}
+	for i := range challenges {
+		api.AssertIsEqual(challenges[i], circuit.Challenges[i])
+	}
+	return arthur.Finish()
+}
+
+func checkMerlinAgainstArthur(t *testing.T, io string, hashName string) {
+	merlin, err := newTestMerlin(hashName, []byte(io))
+	assert.Nil(t, err)
+
+	challengeBytes := make([]byte, 28)
+	assert.Nil(t, merlin.ChallengeBytes(challengeBytes[:8]))
+	assert.Nil(t, merlin.ChallengeBytes(challengeBytes[8:]))
+	reply := []byte{1, 2, 3, 4, 5, 6, 7, 255}
+	assert.Nil(t, merlin.AddBytes(reply))
+	hint := []byte{42, 43, 44}
+	assert.Nil(t, merlin.AddHint(hint))
+	assert.Nil(t, merlin.Ratchet())
+	scalars := []*big.Int{big.NewInt(42), new(big.Int).Sub(ecc.BN254.ScalarField(), big.NewInt(1))}
+	assert.Nil(t, merlin.AddScalars(scalars))
+	challenges := make([]*big.Int, 2)
+	assert.Nil(t, merlin.ChallengeScalars(challenges))
+
+	transcript := uints.NewU8Array(merlin.Transcript())
+	circuit := merlinCircuit{
+		IO:         []byte(io),
+		Hash:       hashName,
+		Transcript: make([]uints.U8, len(transcript)),
+		Bytes:      make([]frontend.Variable, len(challengeBytes)),
+		Reply:      make([]frontend.Variable, len(reply)),
+		Hint:       make([]frontend.Variable, len(hint)),
+		Scalars:    make([]frontend.Variable, len(scalars)),
+		Challenges: make([]frontend.Variable, len(challenges)),
+	}
+	assignment := merlinCircuit{
+		IO:         []byte(io),
+		Hash:       hashName,
+		Transcript: transcript,
+		Bytes:      make([]frontend.Variable, len(challengeBytes)),
+		Reply:      make([]frontend.Variable, len(reply)),
+		Hint:       make([]frontend.Variable, len(hint)),
+		Scalars:    make([]frontend.Variable, len(scalars)),
+		Challenges: make([]frontend.Variable, len(challenges)),
+	}
+	for i, b := range challengeBytes {
+		assignment.Bytes[i] = b
+	}
+	for i, b := range reply {
+		assignment.Reply[i] = b
+	}
+	for i, b := range hint {
+		assignment.Hint[i] = b
+	}
+	for i, s := range scalars {
+		assignment.Scalars[i] = s
+	}
+	for i, c := range challenges {
+		assignment.Challenges[i] = c
+	}
+	err = test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	assert.Nil(t, err)
+}
+
+func TestKeccakMerlinMatchesArthur(t *testing.T) {
+	checkMerlinAgainstArthur(t, "merlin\u0000S8first\u0000S20second\u0000A8reply\u0000Hhint\u0000R\u0000A64scalars\u0000S94challenges", "keccak")
+}
+
+func TestSkyscraperMerlinMatchesArthur(t *testing.T) {
+	checkMerlinAgainstArthur(t, "merlin\u0000S1first\u0000S2second\u0000A8reply\u0000Hhint\u0000R\u0000A2scalars\u0000S2challenges", "skyscraper")
+}
+
+func TestPoseidon2MerlinMatchesArthur(t *testing.T) {
+	checkMerlinAgainstArthur(t, "merlin\u0000S1first\u0000S2second\u0000A8reply\u0000Hhint\u0000R\u0000A2scalars\u0000S2challenges", "poseidon2")
+}
+
+func TestKeccakMerlinRatchet(t *testing.T) {
+	io := "ratchet\u0000A4data\u0000R\u0000S16challenge"
+	merlin, err := NewKeccakMerlin(ecc.BN254.ScalarField(), []byte(io), false)
+	assert.Nil(t, err)
+	assert.NotNil(t, merlin.Ratchet())
+	assert.Nil(t, merlin.AddBytes([]byte{1, 2, 3, 4}))
+	assert.Nil(t, merlin.Ratchet())
+	challenge := make([]byte, 16)
+	assert.Nil(t, merlin.ChallengeBytes(challenge))
+
+	// nimue ratchets by permuting, zeroing the rate and forcing the next
+	// squeeze to permute again
+	tag := generateTag([]byte(io))
+	state := [200]byte{}
+	copy(state[136:], tag[:])
+	copy(state[:], []byte{1, 2, 3, 4})
+	hash.KeccakF(&state)
+	for i := range 136 {
+		state[i] = 0
+	}
+	hash.KeccakF(&state)
+	assert.Equal(t, state[:16], challenge)
+}
+
+func TestSkyscraperMerlinRatchet(t *testing.T) {
+	io := "ratchet\u0000A1data\u0000R\u0000S1challenge"
+	merlin, err := NewSkyscraperMerlin([]byte(io), false)
+	assert.Nil(t, err)
+	assert.Nil(t, merlin.AddScalars([]*big.Int{big.NewInt(5)}))
+	assert.Nil(t, merlin.Ratchet())
+	challenge := make([]*big.Int, 1)
+	assert.Nil(t, merlin.ChallengeScalars(challenge))
+
+	tag := generateTag([]byte(io))
+	slices.Reverse(tag[:])
+	state := [2]fr.Element{}
+	state[0].SetUint64(5)
+	state[1].SetBigInt(new(big.Int).SetBytes(tag[:]))
+	hash.NativeSkyscraperPermute(&state)
+	state[0].SetZero()
+	hash.NativeSkyscraperPermute(&state)
+	assert.Equal(t, state[0].BigInt(new(big.Int)), challenge[0])
+}
+
+func TestMerlinHint(t *testing.T) {
+	merlin, err := NewKeccakMerlin(ecc.BN254.ScalarField(), []byte("hints\u0000A1byte\u0000Hmerkle path"), false)
+	assert.Nil(t, err)
+	assert.NotNil(t, merlin.AddHint([]byte{7}))
+	assert.Nil(t, merlin.AddBytes([]byte{1}))
+	assert.Nil(t, merlin.AddHint([]byte{7, 8}))
+	assert.Equal(t, []byte{1, 2, 0, 0, 0, 7, 8}, merlin.Transcript())
+}
@@ -0,0 +1,60 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// PackedBytesPerElement is the number of transcript bytes packed in one
+// element of the given field, the largest count whose values all fit below
+// the modulus: 31 for BN254.
+func PackedBytesPerElement(field *big.Int) int {
+	return (field.BitLen() - 1) / 8
+}
+
+// PackedTranscriptLen is the number of field elements packing a transcript of
+// the given length.
+func PackedTranscriptLen(field *big.Int, length int) int {
+	n := PackedBytesPerElement(field)
+	return (length + n - 1) / n
+}
+
+// PackTranscript packs the transcript in little-endian chunks of
+// PackedBytesPerElement bytes, the last chunk possibly shorter. It is the
+// out-of-circuit counterpart of UnpackTranscript.
+func PackTranscript(field *big.Int, transcript []byte) []*big.Int {
+	n := PackedBytesPerElement(field)
+	packed := make([]*big.Int, 0, PackedTranscriptLen(field, len(transcript)))
+	for i := 0; i < len(transcript); i += n {
+		chunk := slices.Clone(transcript[i:min(i+n, len(transcript))])
+		slices.Reverse(chunk)
+		packed = append(packed, new(big.Int).SetBytes(chunk))
+	}
+	return packed
+}
+
+// UnpackTranscript returns the length transcript bytes packed by
+// PackTranscript, ready to be passed to an Arthur constructor. Every element
+// is constrained to fit in the bytes of its chunk, so that the unpacking is
+// unique.
+func UnpackTranscript(api frontend.API, packed []frontend.Variable, length int) ([]uints.U8, error) {
+	field := api.Compiler().Field()
+	if len(packed) != PackedTranscriptLen(field, length) {
+		return nil, fmt.Errorf("%d elements do not pack a transcript of %d bytes", len(packed), length)
+	}
+	n := PackedBytesPerElement(field)
+	transcript := make([]uints.U8, 0, length)
+	for i, element := range packed {
+		chunkLen := min(n, length-i*n)
+		leBits := bits.ToBinary(api, element, bits.WithNbDigits(8*chunkLen))
+		for j := range chunkLen {
+			transcript = append(transcript, uints.U8{Val: bits.FromBinary(api, leBits[8*j:8*j+8])})
+		}
+	}
+	return transcript, nil
+}
@@ -0,0 +1,119 @@
+package gnark_nimue
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackTranscript(t *testing.T) {
+	assert.Equal(t, 31, PackedBytesPerElement(ecc.BN254.ScalarField()))
+	assert.Equal(t, 31, PackedBytesPerElement(ecc.BLS12_381.ScalarField()))
+	assert.Equal(t, 0, PackedTranscriptLen(ecc.BN254.ScalarField(), 0))
+	assert.Equal(t, 1, PackedTranscriptLen(ecc.BN254.ScalarField(), 31))
+	assert.Equal(t, 2, PackedTranscriptLen(ecc.BN254.ScalarField(), 32))
+
+	transcript := make([]byte, 33)
+	transcript[0] = 1
+	transcript[30] = 2
+	transcript[32] = 3
+	packed := PackTranscript(ecc.BN254.ScalarField(), transcript)
+	assert.Equal(t, 2, len(packed))
+	first := new(big.Int).Lsh(big.NewInt(2), 8*30)
+	assert.Equal(t, first.Add(first, big.NewInt(1)), packed[0])
+	assert.Equal(t, big.NewInt(3<<8), packed[1])
+}
+
+type packedCircuit struct {
+	Packed [1]frontend.Variable `gnark:",public"`
+}
+
+func (circuit *packedCircuit) Define(api frontend.API) error {
+	transcript, err := UnpackTranscript(api, circuit.Packed[:], len(badTranscript))
+	if err != nil {
+		return err
+	}
+	arthur, err := NewKeccakArthur(api, []byte(badIOPat), transcript, false)
+	if err != nil {
+		return err
+	}
+	challenge := make([]uints.U8, 8)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	reply := make([]uints.U8, 8)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	challenge = make([]uints.U8, 16)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	reply = make([]uints.U8, 16)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+type rawPackedCircuit struct {
+	Packed     []frontend.Variable
+	Transcript []uints.U8
+}
+
+func (circuit *rawPackedCircuit) Define(api frontend.API) error {
+	transcript, err := UnpackTranscript(api, circuit.Packed, len(circuit.Transcript))
+	if err != nil {
+		return err
+	}
+	for i := range transcript {
+		api.AssertIsEqual(transcript[i].Val, circuit.Transcript[i].Val)
+	}
+	return nil
+}
+
+func TestUnpackTranscript(t *testing.T) {
+	packed := PackTranscript(ecc.BN254.ScalarField(), badTranscript)
+	circuit := packedCircuit{}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	assert.Nil(t, err)
+	// the constant one wire and the single packed element
+	assert.Equal(t, 2, ccs.GetNbPublicVariables())
+	assert.Nil(t, test.IsSolved(&circuit, &packedCircuit{Packed: [1]frontend.Variable{packed[0]}}, ecc.BN254.ScalarField()))
+
+	wrong := new(big.Int).Add(packed[0], new(big.Int).Lsh(big.NewInt(1), 8*uint(len(badTranscript))))
+	assert.NotNil(t, test.IsSolved(&circuit, &packedCircuit{Packed: [1]frontend.Variable{wrong}}, ecc.BN254.ScalarField()))
+
+	// several elements, the last one partial
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = byte(13*i + 255)
+	}
+	for _, field := range []*big.Int{ecc.BN254.ScalarField(), ecc.BLS12_377.ScalarField()} {
+		packed = PackTranscript(field, long)
+		rawCircuit := rawPackedCircuit{Packed: make([]frontend.Variable, len(packed)), Transcript: make([]uints.U8, len(long))}
+		assignment := rawPackedCircuit{Packed: make([]frontend.Variable, len(packed)), Transcript: uints.NewU8Array(long)}
+		for i := range packed {
+			assignment.Packed[i] = packed[i]
+		}
+		assert.Nil(t, test.IsSolved(&rawCircuit, &assignment, field))
+
+		// an element overflowing its chunk does not unpack
+		last := len(packed) - 1
+		assignment.Packed[last] = new(big.Int).Add(packed[last], new(big.Int).Lsh(big.NewInt(1), uint(8*(len(long)%PackedBytesPerElement(field)))))
+		assert.NotNil(t, test.IsSolved(&rawCircuit, &assignment, field))
+	}
+
+	_, err = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &rawPackedCircuit{Packed: make([]frontend.Variable, 1), Transcript: make([]uints.U8, 40)})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,215 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Arkworks stores short Weierstrass flags in the two top bits of the last
+// byte of the flagged coordinate.
+const (
+	pointInfinityFlag byte = 1 << 6
+	pointNegativeFlag byte = 1 << 7
+	pointFlagBits          = 2
+)
+
+// pointEncodingSizes returns the byte length of an unflagged and a flagged
+// base field element, following arkworks' buffer_byte_size.
+func pointEncodingSizes(modulus *big.Int) (int, int) {
+	return (modulus.BitLen() + 7) / 8, (modulus.BitLen() + pointFlagBits + 7) / 8
+}
+
+// SerializePoint encodes an affine point the way arkworks serializes short
+// Weierstrass points. The point at infinity is given as (0, 0).
+func SerializePoint(modulus, x, y *big.Int, compressed bool) []byte {
+	plainSize, flaggedSize := pointEncodingSizes(modulus)
+	var flags byte
+	if x.Sign() == 0 && y.Sign() == 0 {
+		flags = pointInfinityFlag
+	} else if new(big.Int).Lsh(y, 1).Cmp(modulus) > 0 {
+		flags = pointNegativeFlag
+	}
+	le := func(v *big.Int, size int) []byte {
+		out := make([]byte, size)
+		v.FillBytes(out)
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+		return out
+	}
+	if compressed {
+		out := le(x, flaggedSize)
+		out[len(out)-1] |= flags
+		return out
+	}
+	out := append(le(x, plainSize), le(y, flaggedSize)...)
+	out[len(out)-1] |= flags
+	return out
+}
+
+// fieldMerlin is the Merlin counterpart of fieldArthur.
+type fieldMerlin interface {
+	addUnits(units []*big.Int, bytes []byte) error
+}
+
+// AddPoints writes affine points to the transcript in arkworks encoding,
+// matching FillNextPoints.
+func AddPoints(merlin Merlin, modulus *big.Int, points [][2]*big.Int, compressed bool) error {
+	if merlin, ok := merlin.(fieldMerlin); ok {
+		if modulus.Cmp(ecc.BN254.ScalarField()) != 0 {
+			return fmt.Errorf("a sponge over the native field cannot absorb points with coordinates modulo %s", modulus)
+		}
+		if !compressed {
+			return fmt.Errorf("field sponges read compressed points")
+		}
+		for _, p := range points {
+			if p[0].Sign() == 0 && p[1].Sign() == 0 {
+				return fmt.Errorf("field sponges cannot absorb the point at infinity")
+			}
+			err := merlin.addUnits([]*big.Int{p[0], p[1]}, SerializePoint(modulus, p[0], p[1], true))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, p := range points {
+		err := merlin.AddBytes(SerializePoint(modulus, p[0], p[1], compressed))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldArthur is implemented by Arthurs over field sponges. nimue absorbs
+// points into such sponges as their affine coordinates rather than as bytes.
+type fieldArthur interface {
+	readBytes(out []uints.U8) error
+	absorbUnits(units []frontend.Variable) error
+}
+
+// coordinateBits decomposes the little-endian encoding of a base field
+// element into its value bits, asserting that the unused high bits are zero.
+// When flagged is set the two top bits of the last byte hold arkworks flags
+// and are returned as infinity and negative.
+func coordinateBits(api frontend.API, modulus *big.Int, bytes []uints.U8, flagged bool) ([]frontend.Variable, frontend.Variable, frontend.Variable) {
+	leBits := make([]frontend.Variable, 0, 8*len(bytes))
+	for _, b := range bytes {
+		leBits = append(leBits, bits.ToBinary(api, b.Val, bits.WithNbDigits(8))...)
+	}
+	var infinity, negative frontend.Variable = 0, 0
+	if flagged {
+		n := len(leBits)
+		infinity, negative = leBits[n-2], leBits[n-1]
+		leBits = leBits[:n-pointFlagBits]
+		// arkworks has no flag for a negative point at infinity
+		api.AssertIsEqual(api.Mul(infinity, negative), 0)
+	}
+	for _, b := range leBits[modulus.BitLen():] {
+		api.AssertIsEqual(b, 0)
+	}
+	return leBits[:modulus.BitLen()], infinity, negative
+}
+
+// assertZeroIf constrains the bits to be zero when cond is set, so that the
+// point at infinity has a single encoding.
+func assertZeroIf(api frontend.API, cond frontend.Variable, leBits []frontend.Variable) {
+	api.AssertIsEqual(api.Mul(cond, api.Add(0, 0, leBits...)), 0)
+}
+
+// FillNextPoints reads affine points in arkworks encoding from the
+// transcript and absorbs them like nimue does. Byte sponges absorb the
+// encoding, either compressed or uncompressed. Field sponges, which nimue only
+// supports for curves over the native field, read the compressed encoding and
+// absorb the coordinates as field elements, so they reject the point at
+// infinity. Points are checked to lie on the curve, flags to be canonical and
+// the point at infinity is returned as (0, 0).
+func FillNextPoints[B, S emulated.FieldParams](api frontend.API, arthur Arthur, curve *sw_emulated.Curve[B, S], out []*sw_emulated.AffinePoint[B], compressed bool) error {
+	var params B
+	modulus := params.Modulus()
+	field, err := emulated.NewField[B](api)
+	if err != nil {
+		return err
+	}
+	fieldSponge, isFieldSponge := arthur.(fieldArthur)
+	if isFieldSponge {
+		if modulus.Cmp(api.Compiler().Field()) != 0 {
+			return fmt.Errorf("a sponge over the native field cannot absorb points with coordinates modulo %s", modulus)
+		}
+		if !compressed {
+			return fmt.Errorf("field sponges read compressed points")
+		}
+	}
+	fillNextBytes := arthur.FillNextBytes
+	if isFieldSponge {
+		fillNextBytes = fieldSponge.readBytes
+	}
+	curveParams := sw_emulated.GetCurveParams[B]()
+	half := new(big.Int).Rsh(modulus, 1)
+
+	plainSize, flaggedSize := pointEncodingSizes(modulus)
+	for i := range out {
+		var x, y *emulated.Element[B]
+		var infinity frontend.Variable
+		if compressed {
+			bytes := make([]uints.U8, flaggedSize)
+			err = fillNextBytes(bytes)
+			if err != nil {
+				return err
+			}
+			xBits, inf, negative := coordinateBits(api, modulus, bytes, true)
+			infinity = inf
+			assertZeroIf(api, infinity, xBits)
+			x = field.FromBits(xBits...)
+			field.AssertIsInRange(x)
+
+			rhs := field.Add(field.Mul(field.Mul(x, x), x), field.NewElement(curveParams.B))
+			if curveParams.A.Sign() != 0 {
+				rhs = field.Add(rhs, field.MulConst(x, curveParams.A))
+			}
+			root := field.ReduceStrict(field.Sqrt(field.Select(infinity, field.Zero(), rhs)))
+			rootIsNegative := isGreaterThanConst(api, field.ToBitsCanonical(root), half)
+			y = field.Select(api.Xor(rootIsNegative, negative), field.Neg(root), root)
+		} else {
+			bytes := make([]uints.U8, plainSize+flaggedSize)
+			err = arthur.FillNextBytes(bytes)
+			if err != nil {
+				return err
+			}
+			// like arkworks, the sign flag is ignored for uncompressed points
+			xBits, _, _ := coordinateBits(api, modulus, bytes[:plainSize], false)
+			yBits, inf, _ := coordinateBits(api, modulus, bytes[plainSize:], true)
+			infinity = inf
+			assertZeroIf(api, infinity, xBits)
+			assertZeroIf(api, infinity, yBits)
+			x = field.FromBits(xBits...)
+			y = field.FromBits(yBits...)
+			field.AssertIsInRange(x)
+			field.AssertIsInRange(y)
+		}
+		out[i] = &sw_emulated.AffinePoint[B]{
+			X: *field.Select(infinity, field.Zero(), x),
+			Y: *field.Select(infinity, field.Zero(), y),
+		}
+		curve.AssertIsOnCurve(out[i])
+		if isFieldSponge {
+			api.AssertIsEqual(infinity, 0)
+			err = fieldSponge.absorbUnits([]frontend.Variable{
+				api.FromBinary(field.ToBitsCanonical(&out[i].X)...),
+				api.FromBinary(field.ToBitsCanonical(&out[i].Y)...),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
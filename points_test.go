@@ -0,0 +1,236 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+type pointsCircuit struct {
+	IO         []byte
+	Compressed bool
+	Transcript []uints.U8
+	Points     []sw_bn254.G1Affine
+}
+
+func (circuit *pointsCircuit) Define(api frontend.API) error {
+	arthur, err := NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+	if err != nil {
+		return err
+	}
+	curve, err := sw_emulated.New[emulated.BN254Fp, emulated.BN254Fr](api, sw_emulated.GetCurveParams[emulated.BN254Fp]())
+	if err != nil {
+		return err
+	}
+	points := make([]*sw_bn254.G1Affine, len(circuit.Points))
+	err = FillNextPoints(api, arthur, curve, points, circuit.Compressed)
+	if err != nil {
+		return err
+	}
+	for i := range points {
+		curve.AssertIsEqual(points[i], &circuit.Points[i])
+	}
+	return arthur.Finish()
+}
+
+func bn254TestPoints() []bn254.G1Affine {
+	_, _, g, _ := bn254.Generators()
+	var neg, five bn254.G1Affine
+	neg.Neg(&g)
+	five.ScalarMultiplication(&g, big.NewInt(5))
+	return []bn254.G1Affine{g, neg, five, {}}
+}
+
+func checkPoints(t *testing.T, compressed bool, transcript func([]byte) []byte) error {
+	modulus := ecc.BN254.BaseField()
+	points := bn254TestPoints()
+	size := 64
+	if compressed {
+		size = 32
+	}
+	io := "points\u0000A" + big.NewInt(int64(size*len(points))).String() + "points"
+
+	merlin, err := NewKeccakMerlin(ecc.BN254.ScalarField(), []byte(io), false)
+	assert.Nil(t, err)
+	coordinates := make([][2]*big.Int, len(points))
+	for i := range points {
+		coordinates[i] = [2]*big.Int{points[i].X.BigInt(new(big.Int)), points[i].Y.BigInt(new(big.Int))}
+	}
+	assert.Nil(t, AddPoints(merlin, modulus, coordinates, compressed))
+
+	circuit := pointsCircuit{
+		IO:         []byte(io),
+		Compressed: compressed,
+		Transcript: make([]uints.U8, len(merlin.Transcript())),
+		Points:     make([]sw_bn254.G1Affine, len(points)),
+	}
+	assignment := pointsCircuit{
+		IO:         []byte(io),
+		Compressed: compressed,
+		Transcript: uints.NewU8Array(transcript(merlin.Transcript())),
+	}
+	for i := range points {
+		assignment.Points = append(assignment.Points, sw_bn254.NewG1Affine(points[i]))
+	}
+	return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+}
+
+func TestSerializePointMatchesArkworks(t *testing.T) {
+	modulus := ecc.BN254.BaseField()
+	one, two := big.NewInt(1), big.NewInt(2)
+	negTwo := new(big.Int).Sub(modulus, two)
+
+	compressed := SerializePoint(modulus, one, two, true)
+	assert.Equal(t, append([]byte{1}, make([]byte, 31)...), compressed)
+	compressed = SerializePoint(modulus, one, negTwo, true)
+	assert.Equal(t, byte(0x80), compressed[31])
+	infinity := SerializePoint(modulus, new(big.Int), new(big.Int), false)
+	assert.Equal(t, 64, len(infinity))
+	assert.Equal(t, byte(0x40), infinity[63])
+}
+
+func TestFillNextPointsCompressed(t *testing.T) {
+	assert.Nil(t, checkPoints(t, true, func(b []byte) []byte { return b }))
+}
+
+func TestFillNextPointsUncompressed(t *testing.T) {
+	assert.Nil(t, checkPoints(t, false, func(b []byte) []byte { return b }))
+}
+
+func TestFillNextPointsRejectsInvalidPoint(t *testing.T) {
+	// flipping the sign flag of the generator decodes to its negation
+	assert.NotNil(t, checkPoints(t, true, func(b []byte) []byte {
+		b[31] ^= pointNegativeFlag
+		return b
+	}))
+	// (1, 3) is not on the curve
+	assert.NotNil(t, checkPoints(t, false, func(b []byte) []byte {
+		b[32] = 3
+		return b
+	}))
+}
+
+func TestFillNextPointsRejectsNonCanonicalFlags(t *testing.T) {
+	// the point at infinity is the fourth point
+	for _, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { b[127] |= pointNegativeFlag; return b },
+		func(b []byte) []byte { b[96] = 1; return b },
+	} {
+		assert.NotNil(t, checkPoints(t, true, corrupt))
+	}
+	for _, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { b[255] |= pointNegativeFlag; return b },
+		func(b []byte) []byte { b[192] = 1; return b },
+		func(b []byte) []byte { b[224] = 1; return b },
+	} {
+		assert.NotNil(t, checkPoints(t, false, corrupt))
+	}
+}
+
+// recordingSponge records what is absorbed into it.
+type recordingSponge struct {
+	absorbed *[]frontend.Variable
+}
+
+func (s recordingSponge) Initialize(iv [32]byte) {}
+
+func (s recordingSponge) Absorb(data []frontend.Variable) {
+	*s.absorbed = append(*s.absorbed, data...)
+}
+
+func (s recordingSponge) Squeeze(out []frontend.Variable) {}
+
+func (s recordingSponge) Ratchet() {}
+
+func (s recordingSponge) PrintState(api frontend.API) {}
+
+type fieldPointsCircuit struct {
+	Transcript  []uints.U8
+	Coordinates []frontend.Variable
+}
+
+func (circuit *fieldPointsCircuit) Define(api frontend.API) error {
+	io := fmt.Sprintf("points\u0000A%dpoints", len(circuit.Coordinates))
+	var absorbed []frontend.Variable
+	sponge := recordingSponge{&absorbed}
+	safe, err := NewSafe[frontend.Variable, recordingSponge](sponge, []byte(io), false)
+	if err != nil {
+		return err
+	}
+	arthur := &nativeArthur[recordingSponge]{api, circuit.Transcript, safe, arthurConfig{}}
+	curve, err := sw_emulated.New[emulated.BN254Fp, emulated.BN254Fr](api, sw_emulated.GetCurveParams[emulated.BN254Fp]())
+	if err != nil {
+		return err
+	}
+	points := make([]*sw_bn254.G1Affine, len(circuit.Coordinates)/2)
+	err = FillNextPoints(api, arthur, curve, points, true)
+	if err != nil {
+		return err
+	}
+	for i := range circuit.Coordinates {
+		api.AssertIsEqual(absorbed[i], circuit.Coordinates[i])
+	}
+	return arthur.Finish()
+}
+
+func TestFillNextPointsFieldSponge(t *testing.T) {
+	// a circuit over the base field of BN254, so that a field sponge absorbs
+	// G1 points as their coordinates
+	modulus := ecc.BN254.BaseField()
+	check := func(points []bn254.G1Affine) error {
+		var transcript []byte
+		var coordinates []frontend.Variable
+		for _, p := range points {
+			x, y := p.X.BigInt(new(big.Int)), p.Y.BigInt(new(big.Int))
+			transcript = append(transcript, SerializePoint(modulus, x, y, true)...)
+			coordinates = append(coordinates, x, y)
+		}
+		circuit := fieldPointsCircuit{Transcript: make([]uints.U8, len(transcript)), Coordinates: make([]frontend.Variable, len(coordinates))}
+		assignment := fieldPointsCircuit{Transcript: uints.NewU8Array(transcript), Coordinates: coordinates}
+		return test.IsSolved(&circuit, &assignment, modulus)
+	}
+	points := bn254TestPoints()
+	assert.Nil(t, check(points[:3]))
+	// arkworks has no coordinates for the point at infinity
+	assert.NotNil(t, check(points[3:]))
+}
+
+type mismatchedPointsCircuit struct {
+	Transcript [32]uints.U8
+}
+
+func (circuit *mismatchedPointsCircuit) Define(api frontend.API) error {
+	arthur, err := NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), []byte("points\u0000A2points"), circuit.Transcript[:], false)
+	if err != nil {
+		return err
+	}
+	curve, err := sw_emulated.New[emulated.BN254Fp, emulated.BN254Fr](api, sw_emulated.GetCurveParams[emulated.BN254Fp]())
+	if err != nil {
+		return err
+	}
+	return FillNextPoints(api, arthur, curve, make([]*sw_bn254.G1Affine, 1), true)
+}
+
+func TestFillNextPointsRejectsForeignField(t *testing.T) {
+	_, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &mismatchedPointsCircuit{})
+	assert.ErrorContains(t, err, "cannot absorb points")
+
+	merlin, err := NewSkyscraperMerlin([]byte("points\u0000A2points"), false)
+	assert.Nil(t, err)
+	_, _, g, _ := bn254.Generators()
+	point := [2]*big.Int{g.X.BigInt(new(big.Int)), g.Y.BigInt(new(big.Int))}
+	err = AddPoints(merlin, ecc.BN254.BaseField(), [][2]*big.Int{point}, true)
+	assert.ErrorContains(t, err, "cannot absorb points")
+}
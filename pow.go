@@ -0,0 +1,262 @@
+package gnark_nimue
+
+import (
+	"encoding/binary"
+	"fmt"
+	mathbits "math/bits"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// PoWStrategy selects the hash used for proof-of-work challenges.
+type PoWStrategy uint8
+
+const (
+	// Blake3PoW is the strategy WHIR uses over byte sponges.
+	Blake3PoW PoWStrategy = iota
+)
+
+func (strategy PoWStrategy) String() string {
+	switch strategy {
+	case Blake3PoW:
+		return "Blake3PoW"
+	}
+	return "Unknown"
+}
+
+const (
+	powChallengeBytes = 32
+	powNonceBytes     = 8
+)
+
+var blake3IV = [8]uint32{0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19}
+
+var blake3Permutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// blake3Flags marks a block as the first and last of the root chunk, which
+// makes the compression of a single 64-byte block its BLAKE3 hash.
+const blake3Flags = 1 | 2 | 8
+
+// blake3G is the BLAKE3 quarter round, generic over native and in-circuit
+// words.
+func blake3G[W any](add func(...W) W, xor func(W, W) W, rotr func(W, int) W, s *[16]W, a, b, c, d int, x, y W) {
+	s[a] = add(s[a], s[b], x)
+	s[d] = rotr(xor(s[d], s[a]), 16)
+	s[c] = add(s[c], s[d])
+	s[b] = rotr(xor(s[b], s[c]), 12)
+	s[a] = add(s[a], s[b], y)
+	s[d] = rotr(xor(s[d], s[a]), 8)
+	s[c] = add(s[c], s[d])
+	s[b] = rotr(xor(s[b], s[c]), 7)
+}
+
+// blake3Compress returns the first 8 output words of the compression of a
+// single root block.
+func blake3Compress[W any](add func(...W) W, xor func(W, W) W, rotr func(W, int) W, constant func(uint32) W, m [16]W) [8]W {
+	var s [16]W
+	for i := range 8 {
+		s[i] = constant(blake3IV[i])
+	}
+	for i := range 4 {
+		s[8+i] = constant(blake3IV[i])
+	}
+	s[12], s[13], s[14], s[15] = constant(0), constant(0), constant(64), constant(blake3Flags)
+	for round := range 7 {
+		blake3G(add, xor, rotr, &s, 0, 4, 8, 12, m[0], m[1])
+		blake3G(add, xor, rotr, &s, 1, 5, 9, 13, m[2], m[3])
+		blake3G(add, xor, rotr, &s, 2, 6, 10, 14, m[4], m[5])
+		blake3G(add, xor, rotr, &s, 3, 7, 11, 15, m[6], m[7])
+		blake3G(add, xor, rotr, &s, 0, 5, 10, 15, m[8], m[9])
+		blake3G(add, xor, rotr, &s, 1, 6, 11, 12, m[10], m[11])
+		blake3G(add, xor, rotr, &s, 2, 7, 8, 13, m[12], m[13])
+		blake3G(add, xor, rotr, &s, 3, 4, 9, 14, m[14], m[15])
+		if round < 6 {
+			var permuted [16]W
+			for i := range permuted {
+				permuted[i] = m[blake3Permutation[i]]
+			}
+			m = permuted
+		}
+	}
+	var out [8]W
+	for i := range out {
+		out[i] = xor(s[i], s[i+8])
+	}
+	return out
+}
+
+// powBlock lays out the challenge and the little-endian nonce, padded with
+// zeros to size bytes.
+func powBlock(challenge [powChallengeBytes]byte, nonce uint64, size int) []byte {
+	block := make([]byte, size)
+	copy(block, challenge[:])
+	binary.LittleEndian.PutUint64(block[powChallengeBytes:], nonce)
+	return block
+}
+
+// powHash returns the 64-bit word whose leading zeros are counted.
+func powHash(strategy PoWStrategy, challenge [powChallengeBytes]byte, nonce uint64) (uint64, error) {
+	switch strategy {
+	case Blake3PoW:
+		block := powBlock(challenge, nonce, 64)
+		var m [16]uint32
+		for i := range m {
+			m[i] = binary.LittleEndian.Uint32(block[4*i:])
+		}
+		add := func(w ...uint32) uint32 {
+			sum := uint32(0)
+			for _, v := range w {
+				sum += v
+			}
+			return sum
+		}
+		xor := func(a, b uint32) uint32 { return a ^ b }
+		rotr := func(a uint32, n int) uint32 { return mathbits.RotateLeft32(a, -n) }
+		constant := func(c uint32) uint32 { return c }
+		out := blake3Compress(add, xor, rotr, constant, m)
+		return uint64(out[0]) | uint64(out[1])<<32, nil
+	}
+	return 0, fmt.Errorf("unknown PoW strategy %v", strategy)
+}
+
+// fieldPoWError is returned for transcripts over field sponges, which WHIR
+// grinds with a field hash instead of Blake3. Running Blake3 there would
+// accept nonces the Rust verifier rejects.
+func fieldPoWError() error {
+	return fmt.Errorf("PoW challenges over field sponges are not supported")
+}
+
+func checkPoWBits(bits int) error {
+	if bits < 0 || bits > 64 {
+		return fmt.Errorf("PoW difficulty of %d bits is out of range", bits)
+	}
+	return nil
+}
+
+// GrindPoW squeezes a PoW challenge, finds the smallest nonce whose hash has
+// at least bits leading zero bits and adds it to the transcript, like nimue's
+// challenge_pow.
+func GrindPoW(merlin Merlin, strategy PoWStrategy, bits int) error {
+	if _, ok := merlin.(fieldMerlin); ok {
+		return fieldPoWError()
+	}
+	err := checkPoWBits(bits)
+	if err != nil {
+		return err
+	}
+	var challenge [powChallengeBytes]byte
+	err = merlin.ChallengeBytes(challenge[:])
+	if err != nil {
+		return err
+	}
+	for nonce := uint64(0); ; nonce++ {
+		h, err := powHash(strategy, challenge, nonce)
+		if err != nil {
+			return err
+		}
+		if mathbits.LeadingZeros64(h) >= bits {
+			return merlin.AddBytes(binary.BigEndian.AppendUint64(nil, nonce))
+		}
+	}
+}
+
+// VerifyPoW reads a PoW nonce and checks it against the squeezed challenge.
+func VerifyPoW(arthur NativeArthur, strategy PoWStrategy, bits int) error {
+	if replay, ok := arthur.(*replayArthur); ok {
+		if _, ok := replay.merlin.(fieldMerlin); ok {
+			return fieldPoWError()
+		}
+	}
+	err := checkPoWBits(bits)
+	if err != nil {
+		return err
+	}
+	var challenge [powChallengeBytes]byte
+	err = arthur.FillChallengeBytes(challenge[:])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, powNonceBytes)
+	err = arthur.FillNextBytes(nonce)
+	if err != nil {
+		return err
+	}
+	h, err := powHash(strategy, challenge, binary.BigEndian.Uint64(nonce))
+	if err != nil {
+		return err
+	}
+	if mathbits.LeadingZeros64(h) < bits {
+		return fmt.Errorf("PoW nonce does not reach %d bits", bits)
+	}
+	return nil
+}
+
+// powHashBytes computes in-circuit the little-endian bytes of the 64-bit word
+// whose leading zeros are counted.
+func powHashBytes(api frontend.API, strategy PoWStrategy, challenge []uints.U8, nonceLE []uints.U8) ([]uints.U8, error) {
+	switch strategy {
+	case Blake3PoW:
+		uapi, err := uints.New[uints.U32](api)
+		if err != nil {
+			return nil, err
+		}
+		block := make([]uints.U8, 64)
+		copy(block, challenge)
+		copy(block[powChallengeBytes:], nonceLE)
+		for i := powChallengeBytes + powNonceBytes; i < len(block); i++ {
+			block[i] = uints.NewU8(0)
+		}
+		var m [16]uints.U32
+		for i := range m {
+			m[i] = uapi.PackLSB(block[4*i : 4*i+4]...)
+		}
+		xor := func(a, b uints.U32) uints.U32 { return uapi.Xor(a, b) }
+		rotr := func(a uints.U32, n int) uints.U32 { return uapi.Lrot(a, -n) }
+		out := blake3Compress(uapi.Add, xor, rotr, uints.NewU32, m)
+		return append(uapi.UnpackLSB(out[0]), uapi.UnpackLSB(out[1])...), nil
+	}
+	return nil, fmt.Errorf("unknown PoW strategy %v", strategy)
+}
+
+// assertPoW constrains the PoW hash of the challenge and the big-endian nonce
+// to start with nbBits zero bits.
+func assertPoW(api frontend.API, strategy PoWStrategy, challenge []uints.U8, nonce []uints.U8, nbBits int) error {
+	nonceLE := make([]uints.U8, powNonceBytes)
+	for i := range nonce {
+		nonceLE[i] = nonce[powNonceBytes-1-i]
+	}
+	h, err := powHashBytes(api, strategy, challenge, nonceLE)
+	if err != nil {
+		return err
+	}
+	hashBits := make([]frontend.Variable, 0, 64)
+	for _, b := range h {
+		hashBits = append(hashBits, bits.ToBinary(api, b.Val, bits.WithNbDigits(8))...)
+	}
+	for _, b := range hashBits[64-nbBits:] {
+		api.AssertIsEqual(b, 0)
+	}
+	return nil
+}
+
+// challengePoW squeezes a 32-byte challenge, reads the 8-byte big-endian nonce
+// and checks the PoW condition, like nimue's challenge_pow.
+func challengePoW(api frontend.API, arthur Arthur, strategy PoWStrategy, nbBits int) error {
+	err := checkPoWBits(nbBits)
+	if err != nil {
+		return err
+	}
+	challenge := make([]uints.U8, powChallengeBytes)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	nonce := make([]uints.U8, powNonceBytes)
+	err = arthur.FillNextBytes(nonce)
+	if err != nil {
+		return err
+	}
+	return assertPoW(api, strategy, challenge, nonce, nbBits)
+}
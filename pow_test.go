@@ -0,0 +1,120 @@
+package gnark_nimue
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// whirPoWChallenge and whirPoWNonce are the first PoW challenge and nonce of
+// the Keccak WHIR transcript in example/main.go, ground with Blake3 to 18 bits.
+var (
+	whirPoWChallenge = [32]byte{0x5c, 0x4b, 0xd0, 0x41, 0x64, 0x92, 0x15, 0x76, 0xa6, 0xa0, 0x51, 0xcc, 0x1a, 0x5c, 0x00, 0xb7, 0xa9, 0x55, 0xf1, 0x21, 0x91, 0xa5, 0xf7, 0xc9, 0xd7, 0x21, 0x00, 0x8e, 0xe2, 0xfa, 0xba, 0x4d}
+	whirPoWNonce     = []byte{0, 0, 0, 0, 0, 9, 109, 64}
+)
+
+type powVectorCircuit struct {
+	Bits      int
+	Challenge []uints.U8
+	Nonce     []uints.U8
+}
+
+func (circuit *powVectorCircuit) Define(api frontend.API) error {
+	return assertPoW(api, Blake3PoW, circuit.Challenge, circuit.Nonce, circuit.Bits)
+}
+
+func TestBlake3PoWMatchesWhir(t *testing.T) {
+	h, err := powHash(Blake3PoW, whirPoWChallenge, 0x96d40)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), h>>(64-18))
+	assert.NotEqual(t, uint64(0), h>>(64-19))
+
+	check := func(bits int) error {
+		circuit := powVectorCircuit{Bits: bits, Challenge: make([]uints.U8, 32), Nonce: make([]uints.U8, 8)}
+		assignment := powVectorCircuit{
+			Bits:      bits,
+			Challenge: uints.NewU8Array(whirPoWChallenge[:]),
+			Nonce:     uints.NewU8Array(whirPoWNonce),
+		}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	assert.Nil(t, check(18))
+	assert.NotNil(t, check(19))
+}
+
+type powCircuit struct {
+	IO         []byte
+	Hash       string
+	Strategy   PoWStrategy
+	Bits       int
+	Transcript []uints.U8
+}
+
+func (circuit *powCircuit) Define(api frontend.API) error {
+	arthur, err := newTestArthur(api, circuit.Hash, circuit.IO, circuit.Transcript, WithPoWStrategy(circuit.Strategy))
+	if err != nil {
+		return err
+	}
+	err = arthur.ChallengePoW(circuit.Bits)
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+func checkPoW(t *testing.T, hashName string, strategy PoWStrategy) {
+	const bits = 8
+	io := buildIO(t, NewIOPattern("pow").WithCodec(testCodec(hashName)).SqueezeBytes(32, "pow_queries").AbsorbBytes(8, "pow-nonce"))
+	merlin, err := newTestMerlin(hashName, io)
+	assert.Nil(t, err)
+	assert.Nil(t, GrindPoW(merlin, strategy, bits))
+	transcript := merlin.Transcript()
+
+	arthur, err := newTestNativeArthur(hashName, io, transcript)
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyPoW(arthur, strategy, bits))
+
+	check := func(transcript []byte) error {
+		circuit := powCircuit{IO: io, Hash: hashName, Strategy: strategy, Bits: bits, Transcript: make([]uints.U8, len(transcript))}
+		assignment := powCircuit{IO: io, Hash: hashName, Strategy: strategy, Bits: bits, Transcript: uints.NewU8Array(transcript)}
+		return test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+	}
+	assert.Nil(t, check(transcript))
+
+	// the smallest nonce reaching the target is ground, so the previous one
+	// fails
+	bad := append([]byte{}, transcript...)
+	if bad[len(bad)-1] > 0 {
+		bad[len(bad)-1]--
+	} else {
+		bad[len(bad)-1]++
+	}
+	arthur, err = newTestNativeArthur(hashName, io, bad)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, VerifyPoW(arthur, strategy, bits), "does not reach 8 bits")
+	assert.NotNil(t, check(bad))
+}
+
+func TestKeccakTranscriptBlake3PoW(t *testing.T) {
+	checkPoW(t, "keccak", Blake3PoW)
+}
+
+func TestFieldSpongePoW(t *testing.T) {
+	io := buildIO(t, NewIOPattern("pow").WithCodec(testCodec("skyscraper")).SqueezeBytes(32, "pow_queries").AbsorbBytes(8, "pow-nonce"))
+	merlin, err := newTestMerlin("skyscraper", io)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, GrindPoW(merlin, Blake3PoW, 8), "not supported")
+
+	arthur, err := newTestNativeArthur("skyscraper", io, make([]byte, 8))
+	assert.Nil(t, err)
+	assert.ErrorContains(t, VerifyPoW(arthur, Blake3PoW, 8), "not supported")
+
+	circuit := powCircuit{IO: io, Hash: "skyscraper", Strategy: Blake3PoW, Bits: 8, Transcript: make([]uints.U8, 8)}
+	_, err = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	assert.ErrorContains(t, err, "not supported")
+}
@@ -0,0 +1,149 @@
+package gnark_nimue
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/consensys/gnark/logger"
+	gnarkprofile "github.com/consensys/gnark/profile"
+	"github.com/google/pprof/profile"
+	"github.com/rs/zerolog"
+)
+
+// ProfileEntry is the cost of the sponge calls of one op of the IO pattern.
+// Consecutive Absorb or Squeeze ops are merged like in GetOpQueue, so Label
+// may join several labels.
+type ProfileEntry struct {
+	Kind        OpKind
+	Label       string
+	Calls       int
+	Constraints int
+}
+
+type profileKey struct {
+	kind  OpKind
+	label string
+}
+
+// Profiler records the constraints spent by the sponge in every Absorb,
+// Squeeze and Ratchet, per op of the IO pattern. Constraints are only
+// recorded while compiling, e.g. with frontend.Compile, and a sponge that
+// permutes lazily charges the permutation to the op that triggers it.
+// Decoding scalars, range checks and proof-of-work are not accounted for.
+//
+// A Profiler is not safe for concurrent use. Every recorded call opens a
+// gnark profile session, which counts all constraints added meanwhile and
+// silences the global gnark logger, so a Profiler must not be used while
+// another gnark profile session is running.
+type Profiler struct {
+	entries []ProfileEntry
+	index   map[profileKey]int
+}
+
+// NewProfiler creates an empty Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{index: make(map[profileKey]int)}
+}
+
+// WithProfiler makes the Arthur record the cost of its sponge calls in
+// profiler. A profiler may be shared by several Arthurs.
+func WithProfiler(profiler *Profiler) ArthurOption {
+	return func(config *arthurConfig) {
+		config.profiler = profiler
+	}
+}
+
+// record runs f, which performs the sponge call of op, and adds the
+// constraints it spent to the entry of op. It only runs f on a nil profiler.
+func (profiler *Profiler) record(op Op, f func()) {
+	if profiler == nil {
+		f()
+		return
+	}
+	constraints := countConstraints(f)
+
+	key := profileKey{op.Kind, string(op.Label)}
+	i, ok := profiler.index[key]
+	if !ok {
+		i = len(profiler.entries)
+		profiler.index[key] = i
+		profiler.entries = append(profiler.entries, ProfileEntry{Kind: op.Kind, Label: key.label})
+	}
+	profiler.entries[i].Calls++
+	profiler.entries[i].Constraints += constraints
+}
+
+// countConstraints runs f in a gnark profile session and returns the
+// constraints it added. The session is stopped and the logger restored even
+// if f panics.
+func countConstraints(f func()) (constraints int) {
+	// gnark logs every profiling session, silence it for our short ones
+	log := logger.Logger()
+	logger.Set(zerolog.Nop())
+	defer logger.Set(log)
+	session := gnarkprofile.Start(gnarkprofile.WithNoOutput())
+	defer func() {
+		session.Stop()
+		constraints = session.NbConstraints()
+	}()
+	f()
+	return
+}
+
+// Entries returns the recorded entries in the order their ops were first
+// performed.
+func (profiler *Profiler) Entries() []ProfileEntry {
+	return append([]ProfileEntry(nil), profiler.entries...)
+}
+
+// TotalConstraints returns the constraints recorded over all entries.
+func (profiler *Profiler) TotalConstraints() int {
+	total := 0
+	for _, entry := range profiler.entries {
+		total += entry.Constraints
+	}
+	return total
+}
+
+// WriteTable writes the entries as an aligned text table, followed by the
+// total.
+func (profiler *Profiler) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcalls\tconstraints\t\tlabel")
+	totalCalls := 0
+	for _, entry := range profiler.entries {
+		totalCalls += entry.Calls
+		fmt.Fprintf(tw, "%v\t%d\t%d\t\t%s\n", entry.Kind, entry.Calls, entry.Constraints, entry.Label)
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t\t\n", totalCalls, profiler.TotalConstraints())
+	return tw.Flush()
+}
+
+// WritePprof writes the entries as a gzipped pprof profile with a
+// constraints and a calls sample per op, to be read with go tool pprof.
+func (profiler *Profiler) WritePprof(w io.Writer) error {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "constraints", Unit: "count"},
+			{Type: "calls", Unit: "count"},
+		},
+	}
+	for i, entry := range profiler.entries {
+		function := &profile.Function{
+			ID:   uint64(i + 1),
+			Name: fmt.Sprintf("%v %s", entry.Kind, entry.Label),
+		}
+		location := &profile.Location{
+			ID:   uint64(i + 1),
+			Line: []profile.Line{{Function: function}},
+		}
+		p.Function = append(p.Function, function)
+		p.Location = append(p.Location, location)
+		p.Sample = append(p.Sample, &profile.Sample{
+			Location: []*profile.Location{location},
+			Value:    []int64{int64(entry.Constraints), int64(entry.Calls)},
+		})
+	}
+	return p.Write(w)
+}
@@ -0,0 +1,138 @@
+package gnark_nimue
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/logger"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/google/pprof/profile"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type profiledCircuit struct {
+	IO         []byte
+	Profiler   *Profiler `gnark:"-"`
+	Skyscraper bool      `gnark:"-"`
+	Transcript [24]uints.U8
+}
+
+func (circuit *profiledCircuit) Define(api frontend.API) error {
+	var arthur Arthur
+	var err error
+	if circuit.Skyscraper {
+		arthur, err = NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), circuit.IO, circuit.Transcript[:], false, WithProfiler(circuit.Profiler))
+	} else {
+		arthur, err = NewKeccakArthur(api, circuit.IO, circuit.Transcript[:], false, WithProfiler(circuit.Profiler))
+	}
+	if err != nil {
+		return err
+	}
+	challenge := make([]uints.U8, 8)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	reply := make([]uints.U8, 8)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	challenge = make([]uints.U8, 16)
+	err = arthur.FillChallengeBytes(challenge)
+	if err != nil {
+		return err
+	}
+	// the second reply in two calls
+	reply = make([]uints.U8, 8)
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	err = arthur.FillNextBytes(reply)
+	if err != nil {
+		return err
+	}
+	err = arthur.Ratchet()
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+func checkProfiler(t *testing.T, useSkyscraper bool, absorbCalls, squeezeCalls int) {
+	codec := ByteCodec(ecc.BN254.ScalarField())
+	if useSkyscraper {
+		codec = FieldCodec(ecc.BN254.ScalarField())
+	}
+	io := NewIOPattern("profile").WithCodec(codec).
+		SqueezeBytes(8, "first challenge").
+		AbsorbBytes(8, "first reply").
+		SqueezeBytes(16, "second challenge").
+		AbsorbBytes(16, "second reply").
+		Ratchet()
+	profiler := NewProfiler()
+	circuit := profiledCircuit{IO: buildIO(t, io), Profiler: profiler, Skyscraper: useSkyscraper}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	assert.Nil(t, err)
+
+	entries := profiler.Entries()
+	assert.Equal(t, 5, len(entries))
+	expected := []ProfileEntry{
+		{Kind: Squeeze, Label: "first challenge", Calls: 1},
+		{Kind: Absorb, Label: "first reply", Calls: absorbCalls},
+		{Kind: Squeeze, Label: "second challenge", Calls: squeezeCalls},
+		{Kind: Absorb, Label: "second reply", Calls: 2 * absorbCalls},
+		{Kind: Ratchet, Calls: 1},
+	}
+	for i := range expected {
+		assert.Equal(t, expected[i].Kind, entries[i].Kind)
+		assert.Equal(t, expected[i].Label, entries[i].Label)
+		assert.Equal(t, expected[i].Calls, entries[i].Calls)
+	}
+	// squeezing after an absorb runs a permutation
+	assert.Greater(t, entries[2].Constraints, 0)
+	assert.LessOrEqual(t, profiler.TotalConstraints(), ccs.GetNbConstraints())
+
+	var table bytes.Buffer
+	assert.Nil(t, profiler.WriteTable(&table))
+	assert.Contains(t, table.String(), "second challenge")
+	assert.Contains(t, table.String(), "total")
+
+	var pprof bytes.Buffer
+	assert.Nil(t, profiler.WritePprof(&pprof))
+	parsed, err := profile.Parse(&pprof)
+	assert.Nil(t, err)
+	assert.Equal(t, len(entries), len(parsed.Sample))
+	total := int64(0)
+	for _, sample := range parsed.Sample {
+		total += sample.Value[0]
+	}
+	assert.Equal(t, int64(profiler.TotalConstraints()), total)
+}
+
+func TestKeccakProfiler(t *testing.T) {
+	checkProfiler(t, false, 1, 1)
+}
+
+func TestSkyscraperProfiler(t *testing.T) {
+	// nativeArthur squeezes one element at a time
+	checkProfiler(t, true, 1, 2)
+}
+
+func TestProfilerRestoresLogger(t *testing.T) {
+	log := logger.Logger()
+	defer logger.Set(log)
+	logger.Set(zerolog.New(io.Discard).Level(zerolog.InfoLevel))
+
+	assert.Panics(t, func() {
+		NewProfiler().record(Op{Kind: Absorb, Label: []byte("panic")}, func() { panic("sponge") })
+	})
+	assert.Equal(t, zerolog.InfoLevel, logger.Logger().GetLevel())
+}
@@ -3,30 +3,12 @@ package gnark_nimue
 import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/reilabs/gnark-nimue/hash"
-	_ "unsafe"
 )
 
 type Safe[U any, H hash.DuplexHash[U]] struct {
-	sponge H
-	ops    OpQueue
-}
-
-//go:linkname keccakF1600 golang.org/x/crypto/sha3.keccakF1600
-func keccakF1600(a *[25]uint64)
-
-func keccakF(a *[200]byte) {
-	b := [25]uint64{}
-	for i := 0; i < 25; i++ {
-		for j := 0; j < 8; j++ {
-			b[i] |= uint64(a[i*8+j]) << uint(j*8)
-		}
-	}
-	keccakF1600(&b)
-	for i := 0; i < 25; i++ {
-		for j := 0; j < 8; j++ {
-			a[i*8+j] = byte(b[i] >> uint(j*8))
-		}
-	}
+	sponge   H
+	ops      OpQueue
+	profiler *Profiler
 }
 
 func generateTag(io []byte) [32]byte {
@@ -35,7 +17,7 @@ func generateTag(io []byte) [32]byte {
 	R := 136
 	for len(io) > 0 {
 		if absorbPos == R {
-			keccakF(&state)
+			hash.KeccakF(&state)
 			absorbPos = 0
 		} else {
 			chunkLen := min(len(io), R-absorbPos)
@@ -45,7 +27,7 @@ func generateTag(io []byte) [32]byte {
 			io = rest
 		}
 	}
-	keccakF(&state)
+	hash.KeccakF(&state)
 	tag := [32]byte{}
 	copy(tag[:], state[:32])
 	return tag
@@ -66,24 +48,53 @@ func NewSafe[U any, H hash.DuplexHash[U]](sponge H, ioStr []byte, ignoreHints bo
 	}, nil
 }
 
+// SetProfiler makes the Safe record the cost of its sponge calls in profiler.
+// A nil profiler disables profiling.
+func (safe *Safe[U, H]) SetProfiler(profiler *Profiler) {
+	safe.profiler = profiler
+}
+
 func (safe *Safe[U, H]) Squeeze(out []U) (err error) {
+	op := safe.ops.next()
 	err = safe.ops.Squeeze(uint64(len(out)))
 	if err != nil {
 		return
 	}
-	safe.sponge.Squeeze(out)
+	safe.profiler.record(op, func() { safe.sponge.Squeeze(out) })
 	return
 }
 
 func (safe *Safe[U, H]) Absorb(in []U) (err error) {
+	op := safe.ops.next()
 	err = safe.ops.Absorb(uint64(len(in)))
 	if err != nil {
 		return
 	}
-	safe.sponge.Absorb(in)
+	safe.profiler.record(op, func() { safe.sponge.Absorb(in) })
 	return
 }
 
+func (safe *Safe[U, H]) Ratchet() (err error) {
+	op := safe.ops.next()
+	err = safe.ops.Ratchet()
+	if err != nil {
+		return
+	}
+	safe.profiler.record(op, safe.sponge.Ratchet)
+	return
+}
+
+// Hint checks that the next op is a Hint. Hints are not absorbed, so the
+// sponge is left untouched.
+func (safe *Safe[U, H]) Hint() error {
+	return safe.ops.Hint()
+}
+
+// Finish checks that every op of the IO pattern other than hints was consumed.
+func (safe *Safe[U, H]) Finish() error {
+	return safe.ops.Finish()
+}
+
 func (safe *Safe[U, H]) PrintState(api frontend.API) {
 	safe.sponge.PrintState(api)
 }
@@ -0,0 +1,133 @@
+// Package sumcheck verifies sumcheck proofs read from a transcript through
+// Arthur.
+package sumcheck
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+)
+
+// Form is the representation of the round polynomials in the transcript.
+type Form uint8
+
+const (
+	// Evaluations sends a round polynomial as its values at 0, 1, ..., degree.
+	Evaluations Form = iota
+	// Coefficients sends a round polynomial as its coefficients, constant
+	// term first.
+	Coefficients
+)
+
+func (form Form) String() string {
+	switch form {
+	case Evaluations:
+		return "Evaluations"
+	case Coefficients:
+		return "Coefficients"
+	}
+	return "Unknown"
+}
+
+// Config describes a sumcheck of the given number of rounds whose round
+// polynomials have at most the given degree.
+type Config struct {
+	Degree int
+	Rounds int
+	Form   Form
+}
+
+func (config Config) check() error {
+	if config.Degree < 1 || config.Rounds < 0 {
+		return fmt.Errorf("invalid sumcheck of %d rounds of degree %d", config.Rounds, config.Degree)
+	}
+	if config.Form != Evaluations && config.Form != Coefficients {
+		return fmt.Errorf("unknown sumcheck form %v", config.Form)
+	}
+	return nil
+}
+
+// AddToIOPattern appends the ops of the sumcheck to io: in every round, the
+// prover sends the round polynomial and the verifier squeezes one challenge.
+func (config Config) AddToIOPattern(io *gnark_nimue.IOPatternBuilder, polyLabel, challengeLabel string) *gnark_nimue.IOPatternBuilder {
+	for range config.Rounds {
+		io.AbsorbScalars(config.Degree+1, polyLabel).SqueezeScalars(1, challengeLabel)
+	}
+	return io
+}
+
+// Verify checks that every round polynomial h satisfies h(0) + h(1) = claim,
+// claim being the initial claim in the first round and the value of the
+// previous round polynomial at its challenge afterwards. It returns the final
+// claim and the challenges, which the caller checks against an evaluation of
+// the summed polynomial.
+func Verify(api frontend.API, arthur gnark_nimue.Arthur, config Config, claim frontend.Variable) (frontend.Variable, []frontend.Variable, error) {
+	err := config.check()
+	if err != nil {
+		return nil, nil, err
+	}
+	point := make([]frontend.Variable, config.Rounds)
+	for i := range point {
+		poly := make([]frontend.Variable, config.Degree+1)
+		err = arthur.FillNextScalars(poly)
+		if err != nil {
+			return nil, nil, err
+		}
+		challenge := make([]frontend.Variable, 1)
+		err = arthur.FillChallengeScalars(challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		point[i] = challenge[0]
+		if config.Form == Evaluations {
+			api.AssertIsEqual(api.Add(poly[0], poly[1]), claim)
+			claim = interpolate(api, poly, point[i])
+		} else {
+			// h(0) + h(1) = c_0 + sum_i c_i
+			api.AssertIsEqual(api.Add(poly[0], poly[0], poly[1:]...), claim)
+			claim = horner(api, poly, point[i])
+		}
+	}
+	return claim, point, nil
+}
+
+// horner evaluates the polynomial of the given coefficients at x.
+func horner(api frontend.API, coeffs []frontend.Variable, x frontend.Variable) frontend.Variable {
+	result := coeffs[len(coeffs)-1]
+	for i := len(coeffs) - 2; i >= 0; i-- {
+		result = api.Add(api.Mul(result, x), coeffs[i])
+	}
+	return result
+}
+
+// interpolate evaluates at x the polynomial of the given values at 0, 1, ...,
+// with the Lagrange basis sum_i evals_i prod_{j != i} (x - j)/(i - j).
+func interpolate(api frontend.API, evals []frontend.Variable, x frontend.Variable) frontend.Variable {
+	n := len(evals)
+	// prefix[i] = prod_{j < i} (x - j), suffix[i] = prod_{j > i} (x - j)
+	prefix := make([]frontend.Variable, n)
+	suffix := make([]frontend.Variable, n)
+	prefix[0] = 1
+	for i := 1; i < n; i++ {
+		prefix[i] = api.Mul(prefix[i-1], api.Sub(x, i-1))
+	}
+	suffix[n-1] = 1
+	for i := n - 2; i >= 0; i-- {
+		suffix[i] = api.Mul(suffix[i+1], api.Sub(x, i+1))
+	}
+	field := api.Compiler().Field()
+	result := frontend.Variable(0)
+	for i := range n {
+		denominator := big.NewInt(1)
+		for j := range n {
+			if j != i {
+				denominator.Mul(denominator, big.NewInt(int64(i-j)))
+			}
+		}
+		weight := denominator.ModInverse(denominator.Mod(denominator, field), field)
+		result = api.Add(result, api.Mul(evals[i], prefix[i], suffix[i], weight))
+	}
+	return result
+}
@@ -0,0 +1,177 @@
+package sumcheck
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+// prove runs the sumcheck of the product of the given multilinear polynomials,
+// given by their values on the hypercube, and returns the challenges and the
+// final claim.
+func prove(t *testing.T, merlin gnark_nimue.Merlin, config Config, tables [][]fr.Element) ([]fr.Element, fr.Element) {
+	var challenges []fr.Element
+	for range config.Rounds {
+		// coefficients of sum_b prod_t (f_t(0, b) + X (f_t(1, b) - f_t(0, b)))
+		poly := make([]fr.Element, config.Degree+1)
+		for j := range len(tables[0]) / 2 {
+			term := []fr.Element{fr.One()}
+			for _, table := range tables {
+				var slope fr.Element
+				slope.Sub(&table[2*j+1], &table[2*j])
+				next := make([]fr.Element, len(term)+1)
+				for k := range term {
+					var m fr.Element
+					next[k].Add(&next[k], m.Mul(&term[k], &table[2*j]))
+					next[k+1].Add(&next[k+1], m.Mul(&term[k], &slope))
+				}
+				term = next
+			}
+			for k := range term {
+				poly[k].Add(&poly[k], &term[k])
+			}
+		}
+		sent := poly
+		if config.Form == Evaluations {
+			sent = make([]fr.Element, len(poly))
+			for x := range sent {
+				sent[x] = evalPoly(poly, fr.NewElement(uint64(x)))
+			}
+		}
+		assert.Nil(t, merlin.AddScalars(toBig(sent)))
+		out := []*big.Int{new(big.Int)}
+		assert.Nil(t, merlin.ChallengeScalars(out))
+		var r fr.Element
+		r.SetBigInt(out[0])
+		challenges = append(challenges, r)
+		for i, table := range tables {
+			bound := make([]fr.Element, len(table)/2)
+			for j := range bound {
+				bound[j].Sub(&table[2*j+1], &table[2*j]).Mul(&bound[j], &r).Add(&bound[j], &table[2*j])
+			}
+			tables[i] = bound
+		}
+	}
+	final := fr.One()
+	for _, table := range tables {
+		final.Mul(&final, &table[0])
+	}
+	return challenges, final
+}
+
+func evalPoly(coeffs []fr.Element, x fr.Element) fr.Element {
+	var result fr.Element
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result.Mul(&result, &x).Add(&result, &coeffs[i])
+	}
+	return result
+}
+
+func toBig(elements []fr.Element) []*big.Int {
+	result := make([]*big.Int, len(elements))
+	for i := range elements {
+		result[i] = elements[i].BigInt(new(big.Int))
+	}
+	return result
+}
+
+type sumcheckCircuit struct {
+	IO         []byte
+	Hash       string
+	Config     Config `gnark:"-"`
+	Transcript []uints.U8
+	Claim      frontend.Variable
+	FinalClaim frontend.Variable
+	Point      []frontend.Variable
+}
+
+func (circuit *sumcheckCircuit) Define(api frontend.API) error {
+	var arthur gnark_nimue.Arthur
+	var err error
+	if circuit.Hash == "skyscraper" {
+		arthur, err = gnark_nimue.NewSkyscraperArthur(api, skyscraper.NewSkyscraper(api, 2), circuit.IO, circuit.Transcript, false)
+	} else {
+		arthur, err = gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+	}
+	if err != nil {
+		return err
+	}
+	claim, point, err := Verify(api, arthur, circuit.Config, circuit.Claim)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(claim, circuit.FinalClaim)
+	for i := range point {
+		api.AssertIsEqual(point[i], circuit.Point[i])
+	}
+	return arthur.Finish()
+}
+
+func checkSumcheck(t *testing.T, hashName string, config Config) {
+	codec := gnark_nimue.ByteCodec(ecc.BN254.ScalarField())
+	if hashName == "skyscraper" {
+		codec = gnark_nimue.FieldCodec(ecc.BN254.ScalarField())
+	}
+	ioPattern, err := config.AddToIOPattern(gnark_nimue.NewIOPattern("sumcheck").WithCodec(codec), "sumcheck_poly", "sumcheck_randomness").Build()
+	assert.Nil(t, err)
+	io := ioPattern.Bytes()
+	var merlin gnark_nimue.Merlin
+	if hashName == "skyscraper" {
+		merlin, err = gnark_nimue.NewSkyscraperMerlin(io, false)
+	} else {
+		merlin, err = gnark_nimue.NewKeccakMerlin(ecc.BN254.ScalarField(), io, false)
+	}
+	assert.Nil(t, err)
+
+	tables := make([][]fr.Element, config.Degree)
+	var claim fr.Element
+	for i := range tables {
+		tables[i] = make([]fr.Element, 1<<config.Rounds)
+		for b := range tables[i] {
+			tables[i][b].SetUint64(uint64(5*b + 3*i + 1))
+		}
+	}
+	for b := range 1 << config.Rounds {
+		term := fr.One()
+		for _, table := range tables {
+			term.Mul(&term, &table[b])
+		}
+		claim.Add(&claim, &term)
+	}
+	point, final := prove(t, merlin, config, tables)
+	transcript := merlin.Transcript()
+
+	circuit := sumcheckCircuit{IO: io, Hash: hashName, Config: config, Transcript: make([]uints.U8, len(transcript)), Point: make([]frontend.Variable, config.Rounds)}
+	assignment := sumcheckCircuit{IO: io, Hash: hashName, Config: config, Transcript: uints.NewU8Array(transcript), Claim: claim, FinalClaim: final, Point: make([]frontend.Variable, config.Rounds)}
+	for i := range point {
+		assignment.Point[i] = point[i]
+	}
+	assert.Nil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+
+	claim.SetOne()
+	assignment.Claim = claim
+	assert.NotNil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+}
+
+func TestEvaluationsSumcheck(t *testing.T) {
+	checkSumcheck(t, "keccak", Config{Degree: 2, Rounds: 4, Form: Evaluations})
+	checkSumcheck(t, "skyscraper", Config{Degree: 3, Rounds: 3, Form: Evaluations})
+}
+
+func TestCoefficientsSumcheck(t *testing.T) {
+	checkSumcheck(t, "keccak", Config{Degree: 3, Rounds: 3, Form: Coefficients})
+	checkSumcheck(t, "skyscraper", Config{Degree: 2, Rounds: 4, Form: Coefficients})
+}
+
+func TestInvalidConfig(t *testing.T) {
+	assert.NotNil(t, Config{Degree: 0, Rounds: 1}.check())
+	assert.NotNil(t, Config{Degree: 2, Rounds: 1, Form: 7}.check())
+}
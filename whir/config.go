@@ -0,0 +1,149 @@
+// Package whir verifies WHIR proofs of evaluation of committed multilinear
+// polynomials over BN254, reading the proof from a nimue transcript through
+// Arthur.
+//
+// The transcript follows the layout of WHIR's add_whir_proof, with the STIR
+// answers and Merkle multi path of every round carried in transcript hints,
+// serialized with arkworks like WHIR's proof.
+package whir
+
+import (
+	"fmt"
+
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	"github.com/reilabs/gnark-nimue/merkle"
+	"github.com/reilabs/gnark-nimue/sumcheck"
+)
+
+// RoundConfig holds the parameters of one folding round.
+type RoundConfig struct {
+	OODSamples int
+	NumQueries int
+	PoWBits    int
+}
+
+// Config describes a WHIR proof for a polynomial in NumVariables variables,
+// committed with a Reed-Solomon code of rate 2^-StartingLogInvRate. Every
+// round folds FoldingFactor variables; the variables left after the last
+// round are sent as the coefficients of the final polynomial.
+type Config struct {
+	DomainSeparator      string
+	NumVariables         int
+	StartingLogInvRate   int
+	FoldingFactor        int
+	CommitmentOODSamples int
+	// StatementPoints is the number of evaluation claims the proof opens.
+	StatementPoints int
+	Rounds          []RoundConfig
+	FinalQueries    int
+	FinalPoWBits    int
+}
+
+// maxDomainBits is the two-adicity of the BN254 scalar field.
+const maxDomainBits = 28
+
+func (config *Config) check() error {
+	if config.FoldingFactor < 1 {
+		return fmt.Errorf("folding factor must be positive, got %d", config.FoldingFactor)
+	}
+	if config.StartingLogInvRate < 1 {
+		return fmt.Errorf("starting rate must be below 1, got 2^-%d", config.StartingLogInvRate)
+	}
+	if config.FinalNumVariables() < 0 {
+		return fmt.Errorf("%d rounds folding %d variables exceed %d variables", len(config.Rounds)+1, config.FoldingFactor, config.NumVariables)
+	}
+	if config.queryBits(len(config.Rounds)) < 1 {
+		return fmt.Errorf("the last oracle must have at least 2 leaves")
+	}
+	if config.domainBits(0) > maxDomainBits {
+		return fmt.Errorf("domain of 2^%d elements is too large", config.domainBits(0))
+	}
+	if config.CommitmentOODSamples+config.StatementPoints == 0 {
+		return fmt.Errorf("the initial sumcheck needs at least one constraint")
+	}
+	return nil
+}
+
+// FinalNumVariables is the number of variables of the final polynomial.
+func (config *Config) FinalNumVariables() int {
+	return config.NumVariables - (len(config.Rounds)+1)*config.FoldingFactor
+}
+
+// domainBits is the log size of the evaluation domain of the oracle sent in
+// the given round, the initial commitment being round 0. Every round halves
+// the domain.
+func (config *Config) domainBits(round int) int {
+	return config.NumVariables + config.StartingLogInvRate - round
+}
+
+// queryBits is the log number of leaves of the oracle sent in the given round.
+func (config *Config) queryBits(round int) int {
+	return config.domainBits(round) - config.FoldingFactor
+}
+
+func (config *Config) numVariables(round int) int {
+	return config.NumVariables - round*config.FoldingFactor
+}
+
+func addDigest(io *gnark_nimue.IOPatternBuilder, codec gnark_nimue.Codec) {
+	if codec.FieldSponge {
+		io.AbsorbScalars(1, "merkle_digest")
+	} else {
+		io.AbsorbBytes(merkle.KeccakDigestSize, "merkle_digest")
+	}
+}
+
+func addOOD(io *gnark_nimue.IOPatternBuilder, samples int) {
+	if samples > 0 {
+		io.SqueezeScalars(samples, "ood_query").AbsorbScalars(samples, "ood_ans")
+	}
+}
+
+// sumcheckConfig is the sumcheck folding the given number of variables. Its
+// polynomials are products of two multilinear polynomials, sent as their
+// values at 0, 1 and 2.
+func sumcheckConfig(rounds int) sumcheck.Config {
+	return sumcheck.Config{Degree: 2, Rounds: rounds, Form: sumcheck.Evaluations}
+}
+
+func addSumcheck(io *gnark_nimue.IOPatternBuilder, rounds int) {
+	sumcheckConfig(rounds).AddToIOPattern(io, "sumcheck_poly", "folding_randomness")
+}
+
+func addPoW(io *gnark_nimue.IOPatternBuilder, bits int) {
+	if bits > 0 {
+		io.SqueezeBytes(32, "pow_queries").AbsorbBytes(8, "pow-nonce")
+	}
+}
+
+func addQueries(io *gnark_nimue.IOPatternBuilder, label string, count, bits, powBits int) {
+	io.SqueezeBytes(count*((bits+7)/8), label)
+	addPoW(io, powBits)
+	io.Hint("stir_answers").Hint("merkle_proof")
+}
+
+// IOPattern returns the IO pattern of a proof for this config. Merkle roots
+// are absorbed as 32 bytes by byte sponges and as one scalar by field
+// sponges.
+func (config *Config) IOPattern(codec gnark_nimue.Codec) (*gnark_nimue.IOPattern, error) {
+	err := config.check()
+	if err != nil {
+		return nil, err
+	}
+	io := gnark_nimue.NewIOPattern(config.DomainSeparator).WithCodec(codec)
+	addDigest(io, codec)
+	addOOD(io, config.CommitmentOODSamples)
+	io.SqueezeScalars(1, "initial_combination_randomness")
+	addSumcheck(io, config.FoldingFactor)
+	for i, round := range config.Rounds {
+		addDigest(io, codec)
+		addOOD(io, round.OODSamples)
+		addQueries(io, "stir_queries", round.NumQueries, config.queryBits(i), round.PoWBits)
+		io.SqueezeScalars(1, "combination_randomness")
+		addSumcheck(io, config.FoldingFactor)
+	}
+	io.AbsorbScalars(1<<config.FinalNumVariables(), "final_coeffs")
+	addQueries(io, "final_queries", config.FinalQueries, config.queryBits(len(config.Rounds)), config.FinalPoWBits)
+	addSumcheck(io, config.FinalNumVariables())
+	return io.Build()
+}
@@ -0,0 +1,48 @@
+package whir
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	"github.com/reilabs/gnark-nimue/merkle"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+)
+
+// Hasher is the Merkle tree hash of the commitments, together with the way
+// their roots are read from the transcript.
+type Hasher[D any] interface {
+	merkle.Hasher[D]
+	FillNextDigest(arthur gnark_nimue.Arthur) (D, error)
+}
+
+type keccakHasher struct {
+	*merkle.Keccak
+}
+
+// NewKeccakHasher hashes commitments with Keccak-256, for transcripts over a
+// byte sponge.
+func NewKeccakHasher(api frontend.API) Hasher[[]uints.U8] {
+	return keccakHasher{merkle.NewKeccak(api)}
+}
+
+func (h keccakHasher) FillNextDigest(arthur gnark_nimue.Arthur) ([]uints.U8, error) {
+	digest := make([]uints.U8, merkle.KeccakDigestSize)
+	err := arthur.FillNextBytes(digest)
+	return digest, err
+}
+
+type skyscraperHasher struct {
+	*merkle.Skyscraper
+}
+
+// NewSkyscraperHasher hashes commitments with Skyscraper, for transcripts
+// over a field sponge.
+func NewSkyscraperHasher(api frontend.API, sc *skyscraper.Skyscraper) Hasher[frontend.Variable] {
+	return skyscraperHasher{merkle.NewSkyscraper(api, sc)}
+}
+
+func (h skyscraperHasher) FillNextDigest(arthur gnark_nimue.Arthur) (frontend.Variable, error) {
+	digest := make([]frontend.Variable, 1)
+	err := arthur.FillNextScalars(digest)
+	return digest[0], err
+}
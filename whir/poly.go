@@ -0,0 +1,145 @@
+package whir
+
+import (
+	"math/big"
+	mathbits "math/bits"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+// rootOfUnity returns the generator of the subgroup of 2^bits elements, picked
+// like arkworks' Radix2EvaluationDomain: a power of 5^((p-1)/2^28).
+func rootOfUnity(bits int) fr.Element {
+	exp := new(big.Int).Sub(fr.Modulus(), big.NewInt(1))
+	exp.Rsh(exp, maxDomainBits)
+	var root fr.Element
+	root.SetUint64(5)
+	root.Exp(root, exp)
+	for range maxDomainBits - bits {
+		root.Square(&root)
+	}
+	return root
+}
+
+func bigInt(e fr.Element) *big.Int {
+	return e.BigInt(new(big.Int))
+}
+
+// powerFromBits returns base^n for n given by its little-endian bits.
+func powerFromBits(api frontend.API, base fr.Element, bits []frontend.Variable) frontend.Variable {
+	result := frontend.Variable(1)
+	one := fr.One()
+	for _, b := range bits {
+		var factor fr.Element
+		factor.Sub(&base, &one)
+		result = api.Mul(result, api.Add(1, api.Mul(b, bigInt(factor))))
+		base.Square(&base)
+	}
+	return result
+}
+
+// powers returns 1, x, ..., x^(n-1).
+func powers(api frontend.API, x frontend.Variable, n int) []frontend.Variable {
+	result := make([]frontend.Variable, n)
+	for i := range result {
+		if i == 0 {
+			result[i] = 1
+		} else {
+			result[i] = api.Mul(result[i-1], x)
+		}
+	}
+	return result
+}
+
+// expand maps a univariate point x to the multilinear point (x, x^2, x^4, ...)
+// of the given number of variables, at which the multilinear polynomial of
+// coefficients c evaluates to the univariate sum_i c_i x^i.
+func expand(api frontend.API, x frontend.Variable, numVariables int) []frontend.Variable {
+	point := make([]frontend.Variable, numVariables)
+	for i := range point {
+		if i == 0 {
+			point[i] = x
+		} else {
+			point[i] = api.Mul(point[i-1], point[i-1])
+		}
+	}
+	return point
+}
+
+// monomials returns the values of the multilinear monomials at point, the
+// monomial of index i being the product of the coordinates at the set bits
+// of i.
+func monomials(api frontend.API, point []frontend.Variable) []frontend.Variable {
+	result := []frontend.Variable{1}
+	for _, x := range point {
+		n := len(result)
+		for i := range n {
+			result = append(result, api.Mul(result[i], x))
+		}
+	}
+	return result
+}
+
+// evalMultilinear evaluates the multilinear polynomial of the given
+// coefficients at point.
+func evalMultilinear(api frontend.API, coeffs []frontend.Variable, point []frontend.Variable) frontend.Variable {
+	result := frontend.Variable(0)
+	for i, m := range monomials(api, point) {
+		result = api.Add(result, api.Mul(coeffs[i], m))
+	}
+	return result
+}
+
+// evalUnivariate evaluates sum_i coeffs_i x^i.
+func evalUnivariate(api frontend.API, coeffs []frontend.Variable, x frontend.Variable) frontend.Variable {
+	result := frontend.Variable(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result = api.Add(api.Mul(result, x), coeffs[i])
+	}
+	return result
+}
+
+// eq evaluates the multilinear extension of equality at (a, b).
+func eq(api frontend.API, a, b []frontend.Variable) frontend.Variable {
+	result := frontend.Variable(1)
+	for i := range a {
+		// a*b + (1-a)*(1-b)
+		ab := api.Mul(a[i], b[i])
+		result = api.Mul(result, api.Sub(api.Add(1, ab, ab), a[i], b[i]))
+	}
+	return result
+}
+
+// foldCoset evaluates the fold of a Merkle leaf. The leaf holds the values
+// f(x*w^t), t < 2^k, of the oracle on the coset of x, w being the generator
+// of the subgroup of 2^k elements. They are interpolated into the polynomial
+// sum_i a_i X^i of degree below 2^k, whose coefficients are then evaluated as
+// a multilinear polynomial at the folding randomness, given by its monomials.
+func foldCoset(api frontend.API, leaf []frontend.Variable, xInv frontend.Variable, foldingMonomials []frontend.Variable) frontend.Variable {
+	size := len(leaf)
+	var wInv, sizeInv fr.Element
+	w := rootOfUnity(mathbits.TrailingZeros(uint(size)))
+	wInv.Inverse(&w)
+	sizeInv.SetUint64(uint64(size))
+	sizeInv.Inverse(&sizeInv)
+
+	result := frontend.Variable(0)
+	xInvPower := frontend.Variable(1)
+	for i := range size {
+		// a_i x^i = 1/2^k sum_t w^(-it) f(x*w^t)
+		var step fr.Element
+		step.Exp(wInv, big.NewInt(int64(i)))
+		c := sizeInv
+		a := frontend.Variable(0)
+		for _, v := range leaf {
+			a = api.Add(a, api.Mul(v, bigInt(c)))
+			c.Mul(&c, &step)
+		}
+		if i > 0 {
+			xInvPower = api.Mul(xInvPower, xInv)
+		}
+		result = api.Add(result, api.Mul(a, xInvPower, foldingMonomials[i]))
+	}
+	return result
+}
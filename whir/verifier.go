@@ -0,0 +1,275 @@
+package whir
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	"github.com/reilabs/gnark-nimue/merkle"
+	"github.com/reilabs/gnark-nimue/sumcheck"
+)
+
+// Statement is the set of evaluation claims a proof opens: the committed
+// polynomial takes the value Evaluations[i] at Points[i]. Coordinate j of a
+// point is the variable of the coefficients whose index has bit j set.
+type Statement struct {
+	Points      [][]frontend.Variable
+	Evaluations []frontend.Variable
+}
+
+// ProofShape is the part of the layout of a proof that depends on its
+// challenges, which the circuit has to be compiled for. PrefixLengths holds
+// the AuthPathsPrefixLengths of the Merkle multi path of every round, the
+// final queries last; there is one per distinct STIR index.
+type ProofShape struct {
+	PrefixLengths [][]int
+}
+
+// constraint is a term coeff*eq(point, X) of the sumcheck weight, over the
+// variables left after offset variables were folded.
+type constraint struct {
+	offset int
+	point  []frontend.Variable
+	coeff  frontend.Variable
+}
+
+type verifier[D any] struct {
+	api         frontend.API
+	arthur      gnark_nimue.Arthur
+	hasher      Hasher[D]
+	config      *Config
+	shape       *ProofShape
+	claim       frontend.Variable
+	constraints []constraint
+	randomness  []frontend.Variable
+}
+
+// Verify checks a WHIR proof of the given shape for the statement and returns
+// the root of the initial commitment, which the caller has to bind to the
+// polynomial.
+func Verify[D any](api frontend.API, arthur gnark_nimue.Arthur, hasher Hasher[D], config Config, shape ProofShape, statement Statement) (D, error) {
+	var root D
+	err := config.check()
+	if err != nil {
+		return root, err
+	}
+	if api.Compiler().Field().Cmp(ecc.BN254.ScalarField()) != 0 {
+		return root, fmt.Errorf("WHIR is only supported over BN254")
+	}
+	if len(statement.Points) != config.StatementPoints || len(statement.Evaluations) != config.StatementPoints {
+		return root, fmt.Errorf("statement has %d points and %d evaluations, expected %d", len(statement.Points), len(statement.Evaluations), config.StatementPoints)
+	}
+	for i, point := range statement.Points {
+		if len(point) != config.NumVariables {
+			return root, fmt.Errorf("statement point %d has %d variables, expected %d", i, len(point), config.NumVariables)
+		}
+	}
+	if len(shape.PrefixLengths) != len(config.Rounds)+1 {
+		return root, fmt.Errorf("proof shape has %d rounds of queries, expected %d", len(shape.PrefixLengths), len(config.Rounds)+1)
+	}
+	v := verifier[D]{api: api, arthur: arthur, hasher: hasher, config: &config, shape: &shape, claim: 0}
+
+	root, err = hasher.FillNextDigest(arthur)
+	if err != nil {
+		return root, err
+	}
+	points, values, err := v.readOOD(config.CommitmentOODSamples, config.NumVariables)
+	if err != nil {
+		return root, err
+	}
+	points = append(points, statement.Points...)
+	values = append(values, statement.Evaluations...)
+	gamma, err := v.challenge()
+	if err != nil {
+		return root, err
+	}
+	v.addConstraints(0, points, values, powers(api, gamma, len(points)))
+	folding, err := v.sumcheck(config.FoldingFactor)
+	if err != nil {
+		return root, err
+	}
+
+	previousRoot := root
+	for i, round := range config.Rounds {
+		nextRoot, err := hasher.FillNextDigest(arthur)
+		if err != nil {
+			return root, err
+		}
+		numVariables := config.numVariables(i + 1)
+		points, values, err := v.readOOD(round.OODSamples, numVariables)
+		if err != nil {
+			return root, err
+		}
+		stirPoints, stirValues, err := v.readQueries(previousRoot, i, round.NumQueries, round.PoWBits, folding)
+		if err != nil {
+			return root, err
+		}
+		gamma, err := v.challenge()
+		if err != nil {
+			return root, err
+		}
+		coeffs := powers(api, gamma, len(points)+len(stirPoints))
+		for _, y := range stirPoints {
+			points = append(points, expand(api, y, numVariables))
+		}
+		v.addConstraints((i+1)*config.FoldingFactor, points, append(values, stirValues...), coeffs)
+		folding, err = v.sumcheck(config.FoldingFactor)
+		if err != nil {
+			return root, err
+		}
+		previousRoot = nextRoot
+	}
+
+	finalCoeffs := make([]frontend.Variable, 1<<config.FinalNumVariables())
+	err = arthur.FillNextScalars(finalCoeffs)
+	if err != nil {
+		return root, err
+	}
+	finalPoints, finalValues, err := v.readQueries(previousRoot, len(config.Rounds), config.FinalQueries, config.FinalPoWBits, folding)
+	if err != nil {
+		return root, err
+	}
+	for i, y := range finalPoints {
+		api.AssertIsEqual(evalUnivariate(api, finalCoeffs, y), finalValues[i])
+	}
+	finalFolding, err := v.sumcheck(config.FinalNumVariables())
+	if err != nil {
+		return root, err
+	}
+
+	weight := frontend.Variable(0)
+	for _, c := range v.constraints {
+		weight = api.Add(weight, api.Mul(c.coeff, eq(api, c.point, v.randomness[c.offset:])))
+	}
+	api.AssertIsEqual(v.claim, api.Mul(weight, evalMultilinear(api, finalCoeffs, finalFolding)))
+	return root, nil
+}
+
+func (v *verifier[D]) challenge() (frontend.Variable, error) {
+	challenge := make([]frontend.Variable, 1)
+	err := v.arthur.FillChallengeScalars(challenge)
+	return challenge[0], err
+}
+
+// readOOD reads out-of-domain samples of the last committed polynomial and
+// returns them as evaluation claims.
+func (v *verifier[D]) readOOD(samples, numVariables int) ([][]frontend.Variable, []frontend.Variable, error) {
+	if samples == 0 {
+		return nil, nil, nil
+	}
+	queries := make([]frontend.Variable, samples)
+	err := v.arthur.FillChallengeScalars(queries)
+	if err != nil {
+		return nil, nil, err
+	}
+	answers := make([]frontend.Variable, samples)
+	err = v.arthur.FillNextScalars(answers)
+	if err != nil {
+		return nil, nil, err
+	}
+	points := make([][]frontend.Variable, samples)
+	for i, z := range queries {
+		points[i] = expand(v.api, z, numVariables)
+	}
+	return points, answers, nil
+}
+
+func (v *verifier[D]) addConstraints(offset int, points [][]frontend.Variable, values []frontend.Variable, coeffs []frontend.Variable) {
+	for i := range points {
+		v.claim = v.api.Add(v.claim, v.api.Mul(coeffs[i], values[i]))
+		v.constraints = append(v.constraints, constraint{offset, points[i], coeffs[i]})
+	}
+}
+
+// sumcheck checks rounds of the WHIR sumcheck and returns their randomness.
+func (v *verifier[D]) sumcheck(rounds int) ([]frontend.Variable, error) {
+	claim, randomness, err := sumcheck.Verify(v.api, v.arthur, sumcheckConfig(rounds), v.claim)
+	if err != nil {
+		return nil, err
+	}
+	v.claim = claim
+	v.randomness = append(v.randomness, randomness...)
+	return randomness, nil
+}
+
+// readQueries derives the STIR queries into the oracle committed in the given
+// round, checks their openings and returns the queried points of the folded
+// domain with the values of the folded oracle there. Like WHIR, every distinct
+// index is opened once, in increasing order.
+func (v *verifier[D]) readQueries(root D, round, count, powBits int, folding []frontend.Variable) ([]frontend.Variable, []frontend.Variable, error) {
+	api := v.api
+	depth := v.config.queryBits(round)
+	prefixLengths := v.shape.PrefixLengths[round]
+	_, indexBits, err := v.arthur.FillChallengeIndices(count, len(prefixLengths), depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if powBits > 0 {
+		err = v.arthur.ChallengePoW(powBits)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	unique := len(indexBits)
+	leafSize := 1 << v.config.FoldingFactor
+	openings, err := v.readAnswers(unique, leafSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = merkle.VerifyMultiPath(api, v.arthur, v.hasher, root, depth, indexBits, openings, prefixLengths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generator := rootOfUnity(v.config.domainBits(round))
+	var generatorInv, foldedGenerator fr.Element
+	generatorInv.Inverse(&generator)
+	foldedGenerator.Exp(generator, big.NewInt(int64(leafSize)))
+	foldingMonomials := monomials(api, folding)
+	points := make([]frontend.Variable, unique)
+	values := make([]frontend.Variable, unique)
+	for i := range unique {
+		xInv := powerFromBits(api, generatorInv, indexBits[i])
+		points[i] = powerFromBits(api, foldedGenerator, indexBits[i])
+		values[i] = foldCoset(api, openings[i], xInv, foldingMonomials)
+	}
+	return points, values, nil
+}
+
+// readAnswers reads the values of the opened leaves from a hint, serialized
+// like WHIR's Vec<Vec<F>> with arkworks: the number of leaves as a
+// little-endian u64, then every leaf as its length and its little-endian
+// scalars.
+func (v *verifier[D]) readAnswers(leaves, leafSize int) ([][]frontend.Variable, error) {
+	api := v.api
+	size := (api.Compiler().FieldBitLen() + 7) / 8
+	bytes := make([]uints.U8, 8+leaves*(8+leafSize*size))
+	err := v.arthur.FillNextHint(bytes)
+	if err != nil {
+		return nil, err
+	}
+	assertLength := func(length int) {
+		for i := range 8 {
+			api.AssertIsEqual(bytes[i].Val, byte(uint64(length)>>(8*i)))
+		}
+		bytes = bytes[8:]
+	}
+	assertLength(leaves)
+	answers := make([][]frontend.Variable, leaves)
+	for i := range answers {
+		assertLength(leafSize)
+		answers[i] = make([]frontend.Variable, leafSize)
+		for j := range answers[i] {
+			answers[i][j] = frontend.Variable(0)
+			for k := size - 1; k >= 0; k-- {
+				answers[i][j] = api.Add(api.Mul(answers[i][j], 256), bytes[k].Val)
+			}
+			bytes = bytes[size:]
+		}
+	}
+	return answers, nil
+}
@@ -0,0 +1,538 @@
+package whir
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	mathbits "math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	gnark_nimue "github.com/reilabs/gnark-nimue"
+	"github.com/reilabs/gnark-nimue/merkle"
+	skyscraper "github.com/reilabs/gnark-skyscraper"
+	"github.com/stretchr/testify/assert"
+)
+
+// exampleConfig is the config of the WHIR proofs in example/main.go. Their
+// PoW nonces pin the difficulty of the rounds to 18, 16 and 16 bits and of
+// the final queries to 9 bits; the fourth round needs between 9 and 14 bits.
+var exampleConfig = Config{
+	DomainSeparator:      "🌪️",
+	NumVariables:         20,
+	StartingLogInvRate:   1,
+	FoldingFactor:        4,
+	CommitmentOODSamples: 1,
+	Rounds: []RoundConfig{
+		{OODSamples: 1, NumQueries: 82, PoWBits: 18},
+		{OODSamples: 1, NumQueries: 21, PoWBits: 16},
+		{OODSamples: 1, NumQueries: 12, PoWBits: 16},
+		{OODSamples: 1, NumQueries: 9, PoWBits: 9},
+	},
+	FinalQueries: 7,
+	FinalPoWBits: 9,
+}
+
+// exampleIOPattern is the IO pattern of the example proofs. WHIR sends the
+// STIR answers and Merkle openings outside the transcript, so it has no hints.
+func exampleIOPattern(t *testing.T) []byte {
+	io, err := exampleConfig.IOPattern(gnark_nimue.ByteCodec(ecc.BN254.ScalarField()))
+	assert.Nil(t, err)
+	io.Ops = slices.DeleteFunc(io.Ops, func(op gnark_nimue.Op) bool { return op.Kind == gnark_nimue.Hint })
+	return io.Bytes()
+}
+
+func TestIOPatternMatchesWhir(t *testing.T) {
+	// the IO pattern of the Keccak WHIR proof in example/main.go
+	expected := "🌪️\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S47initial_combination_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S246stir_queries\u0000S32pow_queries\u0000A8pow-nonce\u0000S47combination_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S42stir_queries\u0000S32pow_queries\u0000A8pow-nonce\u0000S47combination_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S24stir_queries\u0000S32pow_queries\u0000A8pow-nonce\u0000S47combination_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A32merkle_digest\u0000S47ood_query\u0000A32ood_ans\u0000S18stir_queries\u0000S32pow_queries\u0000A8pow-nonce\u0000S47combination_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A96sumcheck_poly\u0000S47folding_randomness\u0000A32final_coeffs\u0000S14final_queries\u0000S32pow_queries\u0000A8pow-nonce"
+	assert.Equal(t, expected, string(exampleIOPattern(t)))
+	assert.Equal(t, expected, string(readTestData(t, "whir_keccak.iopattern")))
+}
+
+// TestExampleTranscript replays the Keccak transcript of the example along
+// the transcript reads of Verify: every PoW nonce has to meet the difficulty
+// of its round, and the distinct STIR indices are the leaves WHIR opens.
+func TestExampleTranscript(t *testing.T) {
+	config := exampleConfig
+	arthur, err := gnark_nimue.NewKeccakNativeArthur(ecc.BN254.ScalarField(), exampleIOPattern(t), readTestData(t, "whir_keccak.transcript"), false)
+	assert.Nil(t, err)
+	scalars := func(n int) []*big.Int {
+		result := make([]*big.Int, n)
+		for i := range result {
+			result[i] = new(big.Int)
+		}
+		return result
+	}
+	sumcheck := func(rounds int) {
+		for range rounds {
+			assert.Nil(t, arthur.FillNextScalars(scalars(3)))
+			assert.Nil(t, arthur.FillChallengeScalars(scalars(1)))
+		}
+	}
+	var unique []int
+	queries := func(round, count, powBits int) {
+		indices, err := gnark_nimue.ChallengeIndices(arthur, count, config.queryBits(round))
+		assert.Nil(t, err)
+		assert.True(t, slices.IsSorted(indices))
+		unique = append(unique, len(indices))
+		assert.Nil(t, gnark_nimue.VerifyPoW(arthur, gnark_nimue.Blake3PoW, powBits), "round %d", round)
+	}
+
+	assert.Nil(t, arthur.FillNextBytes(make([]byte, 32)))
+	assert.Nil(t, arthur.FillChallengeScalars(scalars(config.CommitmentOODSamples)))
+	assert.Nil(t, arthur.FillNextScalars(scalars(config.CommitmentOODSamples)))
+	assert.Nil(t, arthur.FillChallengeScalars(scalars(1)))
+	sumcheck(config.FoldingFactor)
+	for i, round := range config.Rounds {
+		assert.Nil(t, arthur.FillNextBytes(make([]byte, 32)))
+		assert.Nil(t, arthur.FillChallengeScalars(scalars(round.OODSamples)))
+		assert.Nil(t, arthur.FillNextScalars(scalars(round.OODSamples)))
+		queries(i, round.NumQueries, round.PoWBits)
+		assert.Nil(t, arthur.FillChallengeScalars(scalars(1)))
+		sumcheck(config.FoldingFactor)
+	}
+	assert.Nil(t, arthur.FillNextScalars(scalars(1<<config.FinalNumVariables())))
+	queries(len(config.Rounds), config.FinalQueries, config.FinalPoWBits)
+	sumcheck(config.FinalNumVariables())
+	assert.Nil(t, arthur.Finish())
+	// the example queries do not repeat, so a circuit for it opens them all
+	assert.Equal(t, []int{82, 21, 12, 9, 7}, unique)
+}
+
+// readTestData reads a file of the testdata of the module, produced by the
+// Rust provers.
+func readTestData(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "testdata", name))
+	assert.Nil(t, err)
+	return data
+}
+
+func TestConfigCheck(t *testing.T) {
+	config := Config{NumVariables: 4, StartingLogInvRate: 1, FoldingFactor: 2, StatementPoints: 1, Rounds: []RoundConfig{{}, {}}}
+	_, err := config.IOPattern(gnark_nimue.ByteCodec(ecc.BN254.ScalarField()))
+	assert.ErrorContains(t, err, "exceed 4 variables")
+	config.Rounds = nil
+	config.StatementPoints = 0
+	_, err = config.IOPattern(gnark_nimue.ByteCodec(ecc.BN254.ScalarField()))
+	assert.ErrorContains(t, err, "at least one constraint")
+}
+
+// nativeHasher is the out-of-circuit counterpart of Hasher.
+type nativeHasher[D any] struct {
+	leafHash  func([]fr.Element) D
+	compress  func(D, D) D
+	encode    func(D) []byte
+	equal     func(D, D) bool
+	addDigest func(gnark_nimue.Merlin, D) error
+}
+
+var keccakNative = nativeHasher[[]byte]{
+	leafHash:  merkle.KeccakLeafHash,
+	compress:  merkle.KeccakCompress,
+	encode:    func(d []byte) []byte { return d },
+	equal:     bytes.Equal,
+	addDigest: func(merlin gnark_nimue.Merlin, d []byte) error { return merlin.AddBytes(d) },
+}
+
+var skyscraperNative = nativeHasher[fr.Element]{
+	leafHash: merkle.SkyscraperLeafHash,
+	compress: merkle.SkyscraperCompress,
+	encode:   merkle.EncodeSkyscraperDigest,
+	equal:    func(a, b fr.Element) bool { return a == b },
+	addDigest: func(merlin gnark_nimue.Merlin, d fr.Element) error {
+		return merlin.AddScalars([]*big.Int{bigInt(d)})
+	},
+}
+
+// oracle is a committed Reed-Solomon codeword with its Merkle tree.
+type oracle[D any] struct {
+	leaves [][]fr.Element
+	levels [][]D
+}
+
+func (o *oracle[D]) root() D {
+	return o.levels[len(o.levels)-1][0]
+}
+
+func (o *oracle[D]) path(index int) merkle.Path[D] {
+	var authPath []D
+	for level := len(o.levels) - 2; level > 0; level-- {
+		authPath = append(authPath, o.levels[level][(index>>level)^1])
+	}
+	return merkle.Path[D]{LeafIndex: index, LeafSiblingHash: o.levels[0][index^1], AuthPath: authPath}
+}
+
+func univariate(coeffs []fr.Element, x fr.Element) fr.Element {
+	var result fr.Element
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result.Mul(&result, &x).Add(&result, &coeffs[i])
+	}
+	return result
+}
+
+func expandNative(x fr.Element, numVariables int) []fr.Element {
+	point := make([]fr.Element, numVariables)
+	for i := range point {
+		point[i] = x
+		x.Square(&x)
+	}
+	return point
+}
+
+func toBig(elements []fr.Element) []*big.Int {
+	result := make([]*big.Int, len(elements))
+	for i := range elements {
+		result[i] = bigInt(elements[i])
+	}
+	return result
+}
+
+// testProver is a plain WHIR prover for the layout checked by Verify.
+type testProver[D any] struct {
+	t      *testing.T
+	config *Config
+	hasher nativeHasher[D]
+	merlin gnark_nimue.Merlin
+	// coeffs, evals and weights are the current polynomial and the sumcheck
+	// weight, the last two over the boolean hypercube
+	coeffs  []fr.Element
+	evals   []fr.Element
+	weights []fr.Element
+	// duplicates counts the repeated STIR indices
+	duplicates int
+	shape      ProofShape
+}
+
+func (p *testProver[D]) challenge() fr.Element {
+	out := []*big.Int{new(big.Int)}
+	assert.Nil(p.t, p.merlin.ChallengeScalars(out))
+	var e fr.Element
+	e.SetBigInt(out[0])
+	return e
+}
+
+func (p *testProver[D]) commit(round int) *oracle[D] {
+	bits := p.config.domainBits(round)
+	generator := rootOfUnity(bits)
+	numLeaves := 1 << p.config.queryBits(round)
+	leafSize := 1 << p.config.FoldingFactor
+	o := &oracle[D]{leaves: make([][]fr.Element, numLeaves)}
+	x := fr.One()
+	for j := range 1 << bits {
+		leaf := j % numLeaves
+		o.leaves[leaf] = append(o.leaves[leaf], univariate(p.coeffs, x))
+		x.Mul(&x, &generator)
+	}
+	level := make([]D, numLeaves)
+	for i, leaf := range o.leaves {
+		assert.Equal(p.t, leafSize, len(leaf))
+		level[i] = p.hasher.leafHash(leaf)
+	}
+	o.levels = [][]D{level}
+	for len(level) > 1 {
+		next := make([]D, len(level)/2)
+		for i := range next {
+			next[i] = p.hasher.compress(level[2*i], level[2*i+1])
+		}
+		o.levels = append(o.levels, next)
+		level = next
+	}
+	assert.Nil(p.t, p.hasher.addDigest(p.merlin, o.root()))
+	return o
+}
+
+func (p *testProver[D]) ood(samples int) ([][]fr.Element, []fr.Element) {
+	if samples == 0 {
+		return nil, nil
+	}
+	queries := make([]*big.Int, samples)
+	for i := range queries {
+		queries[i] = new(big.Int)
+	}
+	assert.Nil(p.t, p.merlin.ChallengeScalars(queries))
+	points := make([][]fr.Element, samples)
+	answers := make([]fr.Element, samples)
+	numVariables := mathbits.TrailingZeros(uint(len(p.evals)))
+	for i, q := range queries {
+		var z fr.Element
+		z.SetBigInt(q)
+		points[i] = expandNative(z, numVariables)
+		answers[i] = univariate(p.coeffs, z)
+	}
+	assert.Nil(p.t, p.merlin.AddScalars(toBig(answers)))
+	return points, answers
+}
+
+func (p *testProver[D]) addConstraint(point []fr.Element, coeff fr.Element) {
+	one := fr.One()
+	for b := range p.weights {
+		e := coeff
+		for l, z := range point {
+			if b>>l&1 == 1 {
+				e.Mul(&e, &z)
+			} else {
+				var notZ fr.Element
+				notZ.Sub(&one, &z)
+				e.Mul(&e, &notZ)
+			}
+		}
+		p.weights[b].Add(&p.weights[b], &e)
+	}
+}
+
+func (p *testProver[D]) sumcheck(rounds int) {
+	for range rounds {
+		var h [3]fr.Element
+		for j := range len(p.evals) / 2 {
+			f0, f1, w0, w1 := p.evals[2*j], p.evals[2*j+1], p.weights[2*j], p.weights[2*j+1]
+			var t, f2, w2 fr.Element
+			h[0].Add(&h[0], t.Mul(&f0, &w0))
+			h[1].Add(&h[1], t.Mul(&f1, &w1))
+			f2.Double(&f1).Sub(&f2, &f0)
+			w2.Double(&w1).Sub(&w2, &w0)
+			h[2].Add(&h[2], t.Mul(&f2, &w2))
+		}
+		assert.Nil(p.t, p.merlin.AddScalars(toBig(h[:])))
+		r := p.challenge()
+		bind := func(values []fr.Element) []fr.Element {
+			result := make([]fr.Element, len(values)/2)
+			for j := range result {
+				result[j].Sub(&values[2*j+1], &values[2*j]).Mul(&result[j], &r).Add(&result[j], &values[2*j])
+			}
+			return result
+		}
+		p.evals, p.weights = bind(p.evals), bind(p.weights)
+		coeffs := make([]fr.Element, len(p.coeffs)/2)
+		for u := range coeffs {
+			coeffs[u].Mul(&p.coeffs[2*u+1], &r).Add(&coeffs[u], &p.coeffs[2*u])
+		}
+		p.coeffs = coeffs
+	}
+}
+
+// queries opens the oracle of the given round at the distinct STIR indices
+// in increasing order, like WHIR, and returns them.
+func (p *testProver[D]) queries(o *oracle[D], round, count, powBits int) []int {
+	bits := p.config.queryBits(round)
+	size := (bits + 7) / 8
+	bytes := make([]byte, count*size)
+	assert.Nil(p.t, p.merlin.ChallengeBytes(bytes))
+	if powBits > 0 {
+		assert.Nil(p.t, gnark_nimue.GrindPoW(p.merlin, gnark_nimue.Blake3PoW, powBits))
+	}
+	indices := make([]int, count)
+	for i := range count {
+		for _, b := range bytes[i*size : (i+1)*size] {
+			indices[i] = indices[i]<<8 | int(b)
+		}
+		indices[i] %= 1 << bits
+	}
+	slices.Sort(indices)
+	unique := slices.Compact(indices)
+	p.duplicates += count - len(unique)
+	// the answers are a Vec<Vec<F>> serialized with arkworks
+	answers := binary.LittleEndian.AppendUint64(nil, uint64(len(unique)))
+	paths := make([]merkle.Path[D], len(unique))
+	for i, index := range unique {
+		answers = binary.LittleEndian.AppendUint64(answers, uint64(len(o.leaves[index])))
+		for _, v := range o.leaves[index] {
+			answers = append(answers, merkle.EncodeSkyscraperDigest(v)...)
+		}
+		paths[i] = o.path(index)
+	}
+	assert.Nil(p.t, p.merlin.AddHint(answers))
+	multi := merkle.NewMultiPath(paths, p.hasher.equal)
+	p.shape.PrefixLengths = append(p.shape.PrefixLengths, multi.AuthPathsPrefixLengths)
+	assert.Nil(p.t, p.merlin.AddHint(merkle.EncodeMultiPath(multi, p.hasher.encode)))
+	return unique
+}
+
+func (p *testProver[D]) prove(coeffs []fr.Element, points [][]fr.Element) {
+	config := p.config
+	p.coeffs = coeffs
+	// the values on the hypercube are the sums of the coefficients of the
+	// monomials dividing each vertex
+	p.evals = slices.Clone(coeffs)
+	for l := range config.NumVariables {
+		for b := range p.evals {
+			if b>>l&1 == 1 {
+				p.evals[b].Add(&p.evals[b], &p.evals[b^1<<l])
+			}
+		}
+	}
+	p.weights = make([]fr.Element, len(coeffs))
+
+	o := p.commit(0)
+	oodPoints, _ := p.ood(config.CommitmentOODSamples)
+	gamma := p.challenge()
+	coeff := fr.One()
+	for _, point := range append(oodPoints, points...) {
+		p.addConstraint(point, coeff)
+		coeff.Mul(&coeff, &gamma)
+	}
+	p.sumcheck(config.FoldingFactor)
+
+	for i, round := range config.Rounds {
+		next := p.commit(i + 1)
+		oodPoints, _ := p.ood(round.OODSamples)
+		unique := p.queries(o, i, round.NumQueries, round.PoWBits)
+		gamma := p.challenge()
+		coeff := fr.One()
+		for _, point := range oodPoints {
+			p.addConstraint(point, coeff)
+			coeff.Mul(&coeff, &gamma)
+		}
+		var foldedGenerator fr.Element
+		generator := rootOfUnity(config.domainBits(i))
+		foldedGenerator.Exp(generator, big.NewInt(1<<config.FoldingFactor))
+		for _, index := range unique {
+			var y fr.Element
+			y.Exp(foldedGenerator, big.NewInt(int64(index)))
+			p.addConstraint(expandNative(y, config.numVariables(i+1)), coeff)
+			coeff.Mul(&coeff, &gamma)
+		}
+		p.sumcheck(config.FoldingFactor)
+		o = next
+	}
+
+	assert.Nil(p.t, p.merlin.AddScalars(toBig(p.coeffs)))
+	p.queries(o, len(config.Rounds), config.FinalQueries, config.FinalPoWBits)
+	p.sumcheck(config.FinalNumVariables())
+}
+
+type whirCircuit struct {
+	IO          []byte
+	Hash        string
+	Config      Config     `gnark:"-"`
+	Shape       ProofShape `gnark:"-"`
+	Transcript  []uints.U8
+	Points      [][]frontend.Variable
+	Evaluations []frontend.Variable
+}
+
+func (circuit *whirCircuit) Define(api frontend.API) error {
+	statement := Statement{Points: circuit.Points, Evaluations: circuit.Evaluations}
+	var arthur gnark_nimue.Arthur
+	var err error
+	if circuit.Hash == "skyscraper" {
+		sc := skyscraper.NewSkyscraper(api, 2)
+		arthur, err = gnark_nimue.NewSkyscraperArthur(api, sc, circuit.IO, circuit.Transcript, false)
+		if err != nil {
+			return err
+		}
+		_, err = Verify(api, arthur, NewSkyscraperHasher(api, sc), circuit.Config, circuit.Shape, statement)
+	} else {
+		arthur, err = gnark_nimue.NewKeccakArthur(api, circuit.IO, circuit.Transcript, false)
+		if err != nil {
+			return err
+		}
+		_, err = Verify(api, arthur, NewKeccakHasher(api), circuit.Config, circuit.Shape, statement)
+	}
+	if err != nil {
+		return err
+	}
+	return arthur.Finish()
+}
+
+var testConfig = Config{
+	DomainSeparator:      "whir-test",
+	NumVariables:         5,
+	StartingLogInvRate:   1,
+	FoldingFactor:        2,
+	CommitmentOODSamples: 1,
+	StatementPoints:      1,
+	Rounds:               []RoundConfig{{OODSamples: 1, NumQueries: 12, PoWBits: 2}},
+	FinalQueries:         4,
+	FinalPoWBits:         1,
+}
+
+func checkVerify[D any](t *testing.T, hashName string, hasher nativeHasher[D]) {
+	config := testConfig
+	codec := gnark_nimue.ByteCodec(ecc.BN254.ScalarField())
+	newMerlin := func(io []byte) (gnark_nimue.Merlin, error) {
+		return gnark_nimue.NewKeccakMerlin(ecc.BN254.ScalarField(), io, false)
+	}
+	if hashName == "skyscraper" {
+		// WHIR grinds field transcripts with a field hash, which is not
+		// supported
+		config.Rounds = []RoundConfig{{OODSamples: 1, NumQueries: 12}}
+		config.FinalPoWBits = 0
+		codec = gnark_nimue.FieldCodec(ecc.BN254.ScalarField())
+		newMerlin = func(io []byte) (gnark_nimue.Merlin, error) {
+			return gnark_nimue.NewSkyscraperMerlin(io, false)
+		}
+	}
+	ioPattern, err := config.IOPattern(codec)
+	assert.Nil(t, err)
+	io := ioPattern.Bytes()
+	merlin, err := newMerlin(io)
+	assert.Nil(t, err)
+
+	coeffs := make([]fr.Element, 1<<config.NumVariables)
+	for i := range coeffs {
+		coeffs[i].SetUint64(uint64(7*i*i + 3))
+	}
+	point := make([]fr.Element, config.NumVariables)
+	for i := range point {
+		point[i].SetUint64(uint64(11 + i))
+	}
+	var evaluation fr.Element
+	for i := range coeffs {
+		m := coeffs[i]
+		for l := range point {
+			if i>>l&1 == 1 {
+				m.Mul(&m, &point[l])
+			}
+		}
+		evaluation.Add(&evaluation, &m)
+	}
+
+	prover := testProver[D]{t: t, config: &config, hasher: hasher, merlin: merlin}
+	prover.prove(coeffs, [][]fr.Element{point})
+	assert.Nil(t, merlin.Finish())
+	// the STIR queries of the test config repeat indices, which WHIR combines
+	// once
+	assert.NotZero(t, prover.duplicates)
+	transcript := merlin.Transcript()
+
+	circuit := whirCircuit{
+		IO:          io,
+		Hash:        hashName,
+		Config:      config,
+		Shape:       prover.shape,
+		Transcript:  make([]uints.U8, len(transcript)),
+		Points:      [][]frontend.Variable{make([]frontend.Variable, config.NumVariables)},
+		Evaluations: make([]frontend.Variable, 1),
+	}
+	assignment := whirCircuit{
+		IO:          io,
+		Hash:        hashName,
+		Config:      config,
+		Shape:       prover.shape,
+		Transcript:  uints.NewU8Array(transcript),
+		Points:      [][]frontend.Variable{make([]frontend.Variable, config.NumVariables)},
+		Evaluations: []frontend.Variable{evaluation},
+	}
+	for i := range point {
+		assignment.Points[0][i] = point[i]
+	}
+	assert.Nil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+
+	assignment.Evaluations[0] = 1
+	assert.NotNil(t, test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()))
+}
+
+func TestKeccakVerify(t *testing.T) {
+	checkVerify(t, "keccak", keccakNative)
+}
+
+func TestSkyscraperVerify(t *testing.T) {
+	checkVerify(t, "skyscraper", skyscraperNative)
+}